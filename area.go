@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// AreaZoneResult is the outcome of a command sent to one zone of an area.
+type AreaZoneResult struct {
+	Zone ZoneDefinition
+	Err  error
+}
+
+// isLightZone reports whether area-wide commands should control the zone.
+// Controllers that don't categorize zones are assumed to use dimmed and
+// switched zones for lights.
+func isLightZone(zone ZoneDefinition) bool {
+	if zone.Category.Type != "" {
+		return zone.Category.IsLight
+	}
+
+	switch zone.ControlType {
+	case "Dimmed", "Switched", "WhiteTune", "SpectrumTune", "ColorTune":
+		return true
+	default:
+		return false
+	}
+}
+
+// AreaZones gets the zones in the area and all of its child areas. A zone is
+// in an area if it is associated with it directly, or if the device it belongs
+// to is.
+func (c *Client) AreaZones(areaID string) ([]ZoneDefinition, error) {
+	return c.AreaZonesContext(context.Background(), areaID)
+}
+
+// AreaZonesContext is like AreaZones but uses the provided context.
+func (c *Client) AreaZonesContext(ctx context.Context, areaID string) ([]ZoneDefinition, error) {
+	areas, err := c.AreasContext(ctx)
+	if err != nil {
+		return []ZoneDefinition{}, err
+	}
+	devices, err := c.DevicesContext(ctx)
+	if err != nil {
+		return []ZoneDefinition{}, err
+	}
+	zones, err := c.ZonesContext(ctx)
+	if err != nil {
+		return []ZoneDefinition{}, err
+	}
+
+	root := fmt.Sprintf("/area/%s", areaID)
+	found := false
+	children := map[string][]string{}
+	for _, area := range areas {
+		children[area.Parent.Href] = append(children[area.Parent.Href], area.Href)
+		if area.Href == root {
+			found = true
+		}
+	}
+	if !found {
+		return []ZoneDefinition{}, &NameNotFoundError{Kind: "area", Name: areaID}
+	}
+
+	inArea := map[string]bool{}
+	queue := []string{root}
+	for len(queue) > 0 {
+		href := queue[0]
+		queue = queue[1:]
+		if inArea[href] {
+			continue
+		}
+		inArea[href] = true
+		queue = append(queue, children[href]...)
+	}
+
+	inAreaDevices := map[string]bool{}
+	for _, area := range areas {
+		if inArea[area.Href] {
+			for _, d := range area.AssociatedDevices {
+				inAreaDevices[d.Href] = true
+			}
+		}
+	}
+	for _, device := range devices {
+		if inArea[device.AssociatedArea.Href] {
+			inAreaDevices[device.Href] = true
+		}
+	}
+
+	result := []ZoneDefinition{}
+	for _, zone := range zones {
+		if inArea[zone.AssociatedArea.Href] || inAreaDevices[zone.Device.Href] {
+			result = append(result, zone)
+		}
+	}
+
+	return result, nil
+}
+
+// areaLights sends a command to every light zone in the area concurrently,
+// collecting the result for each zone.
+func (c *Client) areaLights(ctx context.Context, areaID string, command func(id string, zone ZoneDefinition) error) ([]AreaZoneResult, error) {
+	zones, err := c.AreaZonesContext(ctx, areaID)
+	if err != nil {
+		return []AreaZoneResult{}, err
+	}
+
+	results := []AreaZoneResult{}
+	for _, zone := range zones {
+		if isLightZone(zone) {
+			results = append(results, AreaZoneResult{Zone: zone})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(r *AreaZoneResult) {
+			defer wg.Done()
+			r.Err = command(idFromHref(r.Zone.Href), r.Zone)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// AreaDim dims every light in the area and its child areas to the provided
+// level. Switched zones are turned on for any level above 0. The commands are
+// sent concurrently; the result for each zone is returned.
+func (c *Client) AreaDim(areaID string, options DimOptions) ([]AreaZoneResult, error) {
+	return c.AreaDimContext(context.Background(), areaID, options)
+}
+
+// AreaDimContext is like AreaDim but uses the provided context.
+func (c *Client) AreaDimContext(ctx context.Context, areaID string, options DimOptions) ([]AreaZoneResult, error) {
+	return c.areaLights(ctx, areaID, func(id string, zone ZoneDefinition) error {
+		if zone.ControlType == "Switched" {
+			return c.zonePower(ctx, id, options.Level > 0, options)
+		}
+		_, err := c.ZoneDimContext(ctx, id, options)
+		return err
+	})
+}
+
+// AreaOn turns on every light in the area and its child areas (see ZoneOn).
+func (c *Client) AreaOn(areaID string, options DimOptions) ([]AreaZoneResult, error) {
+	return c.AreaOnContext(context.Background(), areaID, options)
+}
+
+// AreaOnContext is like AreaOn but uses the provided context.
+func (c *Client) AreaOnContext(ctx context.Context, areaID string, options DimOptions) ([]AreaZoneResult, error) {
+	return c.areaLights(ctx, areaID, func(id string, zone ZoneDefinition) error {
+		return c.ZoneOnContext(ctx, id, options)
+	})
+}
+
+// AreaOff turns off every light in the area and its child areas (see ZoneOff).
+func (c *Client) AreaOff(areaID string, options DimOptions) ([]AreaZoneResult, error) {
+	return c.AreaOffContext(context.Background(), areaID, options)
+}
+
+// AreaOffContext is like AreaOff but uses the provided context.
+func (c *Client) AreaOffContext(ctx context.Context, areaID string, options DimOptions) ([]AreaZoneResult, error) {
+	return c.areaLights(ctx, areaID, func(id string, zone ZoneDefinition) error {
+		return c.ZoneOffContext(ctx, id, options)
+	})
+}
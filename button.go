@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+type ButtonGroupDefinition struct {
+	Href string `json:"href"`
+
+	ProgrammingType string
+	SortOrder       int
+	StopIfMoving    string
+
+	AffectedZones []HrefObject
+	Buttons       []HrefObject
+	Parent        HrefObject
+}
+
+type MultipleButtonGroupDefinition struct {
+	ButtonGroups []ButtonGroupDefinition
+}
+
+type OneButtonGroupDefinition struct {
+	ButtonGroup ButtonGroupDefinition
+}
+
+// ButtonGroups gets the list of button groups (keypads, Picos, etc.) defined
+// on this controller.
+func (c *Client) ButtonGroups() ([]ButtonGroupDefinition, error) {
+	return c.ButtonGroupsContext(context.Background())
+}
+
+// ButtonGroupsContext is like ButtonGroups but uses the provided context.
+func (c *Client) ButtonGroupsContext(ctx context.Context) ([]ButtonGroupDefinition, error) {
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		return snap.ButtonGroups, nil
+	}
+
+	return c.fetchButtonGroups(ctx)
+}
+
+func (c *Client) fetchButtonGroups(ctx context.Context) ([]ButtonGroupDefinition, error) {
+	body, err := c.GetContext(ctx, "/buttongroup")
+	if err != nil {
+		return []ButtonGroupDefinition{}, err
+	}
+
+	var res MultipleButtonGroupDefinition
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return []ButtonGroupDefinition{}, err
+	}
+
+	return res.ButtonGroups, nil
+}
+
+// ButtonGroup gets information about the specified button group.
+func (c *Client) ButtonGroup(id string) (ButtonGroupDefinition, error) {
+	return c.ButtonGroupContext(context.Background(), id)
+}
+
+// ButtonGroupContext is like ButtonGroup but uses the provided context.
+func (c *Client) ButtonGroupContext(ctx context.Context, id string) (ButtonGroupDefinition, error) {
+	href := fmt.Sprintf("/buttongroup/%s", id)
+
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		for _, group := range snap.ButtonGroups {
+			if group.Href == href {
+				return group, nil
+			}
+		}
+	}
+
+	body, err := c.GetContext(ctx, href)
+	if err != nil {
+		return ButtonGroupDefinition{}, err
+	}
+
+	var res OneButtonGroupDefinition
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return ButtonGroupDefinition{}, err
+	}
+
+	return res.ButtonGroup, nil
+}
+
+type ButtonDefinition struct {
+	Href string `json:"href"`
+	Name string
+
+	ButtonNumber int
+	Engraving    struct {
+		Text string
+	}
+
+	AssociatedLED    HrefObject
+	Parent           HrefObject
+	ProgrammingModel HrefObject
+}
+
+type MultipleButtonDefinition struct {
+	Buttons []ButtonDefinition
+}
+
+type OneButtonDefinition struct {
+	Button ButtonDefinition
+}
+
+// Buttons gets the list of buttons defined on this controller.
+func (c *Client) Buttons() ([]ButtonDefinition, error) {
+	return c.ButtonsContext(context.Background())
+}
+
+// ButtonsContext is like Buttons but uses the provided context.
+func (c *Client) ButtonsContext(ctx context.Context) ([]ButtonDefinition, error) {
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		return snap.Buttons, nil
+	}
+
+	return c.fetchButtons(ctx)
+}
+
+func (c *Client) fetchButtons(ctx context.Context) ([]ButtonDefinition, error) {
+	body, err := c.GetContext(ctx, "/button")
+	if err != nil {
+		return []ButtonDefinition{}, err
+	}
+
+	var res MultipleButtonDefinition
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return []ButtonDefinition{}, err
+	}
+
+	return res.Buttons, nil
+}
+
+// Button gets information about the specified button.
+func (c *Client) Button(id string) (ButtonDefinition, error) {
+	return c.ButtonContext(context.Background(), id)
+}
+
+// ButtonContext is like Button but uses the provided context.
+func (c *Client) ButtonContext(ctx context.Context, id string) (ButtonDefinition, error) {
+	href := fmt.Sprintf("/button/%s", id)
+
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		for _, button := range snap.Buttons {
+			if button.Href == href {
+				return button, nil
+			}
+		}
+	}
+
+	body, err := c.GetContext(ctx, href)
+	if err != nil {
+		return ButtonDefinition{}, err
+	}
+
+	var res OneButtonDefinition
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return ButtonDefinition{}, err
+	}
+
+	return res.Button, nil
+}
+
+// ButtonAction is a command accepted by a button's command processor.
+type ButtonAction string
+
+const (
+	PressAndRelease ButtonAction = "PressAndRelease"
+	PressAndHold    ButtonAction = "PressAndHold"
+	Release         ButtonAction = "Release"
+)
+
+type ButtonCommand struct {
+	CommandType ButtonAction
+}
+
+type ButtonCommandBody struct {
+	Command ButtonCommand
+}
+
+// ButtonPress sends the action to the button, as if it had been pressed on
+// the keypad. A `PressAndHold` should be followed by a `Release`.
+func (c *Client) ButtonPress(id string, action ButtonAction) error {
+	return c.ButtonPressContext(context.Background(), id, action)
+}
+
+// ButtonPressContext is like ButtonPress but uses the provided context.
+func (c *Client) ButtonPressContext(ctx context.Context, id string, action ButtonAction) error {
+	body := ButtonCommandBody{
+		Command: ButtonCommand{
+			CommandType: action,
+		},
+	}
+
+	_, err := c.PostContext(ctx, fmt.Sprintf("/button/%s/commandprocessor", id), body)
+	return err
+}
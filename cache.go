@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a cached snapshot is trusted when Client.CacheTTL
+// is unset, even if the project revision hasn't changed.
+const DefaultCacheTTL = 24 * time.Hour
+
+// Snapshot is a copy of the controller's project topology: everything needed
+// to resolve names and map devices to zones without a round trip.
+type Snapshot struct {
+	Host      string
+	Revision  string
+	FetchedAt time.Time
+
+	Areas          []AreaDefinition
+	Zones          []ZoneDefinition
+	Devices        []DeviceDefinition
+	ButtonGroups   []ButtonGroupDefinition
+	Buttons        []ButtonDefinition
+	VirtualButtons []VirtualButtonDefinition
+}
+
+// LoadSnapshot reads a snapshot from the cache file at path.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	err = json.Unmarshal(raw, &snap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snap, nil
+}
+
+// Save writes the snapshot to the cache file at path, replacing it atomically.
+func (s *Snapshot) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, raw, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// ProjectRevision returns a fingerprint of the controller's `/project`
+// definition, which changes whenever the project is reprogrammed.
+func (c *Client) ProjectRevision() (string, error) {
+	return c.ProjectRevisionContext(context.Background())
+}
+
+// ProjectRevisionContext is like ProjectRevision but uses the provided context.
+func (c *Client) ProjectRevisionContext(ctx context.Context) (string, error) {
+	body, err := c.GetContext(ctx, "/project")
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// SnapshotFresh reports whether the snapshot can still be used: it must come
+// from this client's host, be younger than the cache TTL, and match the
+// controller's current project revision.
+func (c *Client) SnapshotFresh(snap *Snapshot) (bool, error) {
+	return c.SnapshotFreshContext(context.Background(), snap)
+}
+
+// SnapshotFreshContext is like SnapshotFresh but uses the provided context.
+func (c *Client) SnapshotFreshContext(ctx context.Context, snap *Snapshot) (bool, error) {
+	ttl := c.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	if snap.Host != c.Host || time.Since(snap.FetchedAt) > ttl {
+		return false, nil
+	}
+
+	revision, err := c.ProjectRevisionContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return revision == snap.Revision, nil
+}
+
+// RefreshCache fetches a new snapshot from the controller and writes it to
+// the cache file.
+func (c *Client) RefreshCache() (*Snapshot, error) {
+	return c.RefreshCacheContext(context.Background())
+}
+
+// RefreshCacheContext is like RefreshCache but uses the provided context.
+func (c *Client) RefreshCacheContext(ctx context.Context) (*Snapshot, error) {
+	if c.CachePath == "" {
+		return nil, errors.New("no cache path configured")
+	}
+
+	snap, err := c.fetchSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = snap.Save(c.CachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cacheMu.Lock()
+	c.snapshot = snap
+	c.cacheChecked = true
+	c.cacheMu.Unlock()
+
+	return snap, nil
+}
+
+// ClearCache removes the cache file.
+func (c *Client) ClearCache() error {
+	c.cacheMu.Lock()
+	c.snapshot = nil
+	c.cacheChecked = false
+	c.cacheMu.Unlock()
+
+	if c.CachePath == "" {
+		return nil
+	}
+
+	err := os.Remove(c.CachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// fetchSnapshot reads the project topology from the controller. The requests
+// are sent concurrently over the client's session. Controllers that don't
+// have buttons or virtual buttons report them as not found, which leaves
+// those lists empty.
+func (c *Client) fetchSnapshot(ctx context.Context) (*Snapshot, error) {
+	revision, err := c.ProjectRevisionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Host:      c.Host,
+		Revision:  revision,
+		FetchedAt: time.Now(),
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 6)
+	fetch := func(i int, optional bool, f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := f()
+			if optional && IsNotFound(err) {
+				err = nil
+			}
+			errs[i] = err
+		}()
+	}
+
+	fetch(0, false, func() (err error) { snap.Areas, err = c.fetchAreas(ctx); return })
+	fetch(1, false, func() (err error) { snap.Zones, err = c.fetchZones(ctx); return })
+	fetch(2, false, func() (err error) { snap.Devices, err = c.fetchDevices(ctx); return })
+	fetch(3, true, func() (err error) { snap.ButtonGroups, err = c.fetchButtonGroups(ctx); return })
+	fetch(4, true, func() (err error) { snap.Buttons, err = c.fetchButtons(ctx); return })
+	fetch(5, true, func() (err error) { snap.VirtualButtons, err = c.fetchVirtualButtons(ctx); return })
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return snap, nil
+}
+
+// cachedSnapshot returns the snapshot typed accessors should serve from, or
+// nil if caching is disabled or unavailable. The cache file is checked once
+// per client, and refreshed if it is missing or stale.
+func (c *Client) cachedSnapshot(ctx context.Context) *Snapshot {
+	if c.CachePath == "" {
+		return nil
+	}
+
+	c.cacheLoadMu.Lock()
+	defer c.cacheLoadMu.Unlock()
+
+	c.cacheMu.Lock()
+	if c.cacheChecked {
+		defer c.cacheMu.Unlock()
+		return c.snapshot
+	}
+	c.cacheMu.Unlock()
+
+	snap, err := LoadSnapshot(c.CachePath)
+	if err == nil {
+		fresh, err := c.SnapshotFreshContext(ctx, snap)
+		if err != nil || !fresh {
+			snap = nil
+		}
+	} else {
+		snap = nil
+	}
+
+	if snap == nil {
+		snap, err = c.RefreshCacheContext(ctx)
+		if err != nil {
+			if c.Verbose {
+				os.Stderr.WriteString(fmt.Sprintln("cache: refresh failed:", err))
+			}
+			snap = nil
+		}
+	}
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.snapshot = snap
+	c.cacheChecked = true
+
+	return snap
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paulrosania/tron/leaptest"
+)
+
+// newCachedClient returns a client for srv that caches its snapshot at path.
+func newCachedClient(t *testing.T, srv *leaptest.Server, path string) *Client {
+	t.Helper()
+
+	c := newTestClient(t, srv)
+	c.CachePath = path
+	return c
+}
+
+// reads returns the paths of the read requests srv received after the first
+// skip requests.
+func reads(srv *leaptest.Server, skip int) []string {
+	paths := []string{}
+	for _, req := range srv.Requests()[skip:] {
+		if req.CommuniqueType == "ReadRequest" {
+			paths = append(paths, req.Header.URL)
+		}
+	}
+	return paths
+}
+
+func TestCacheLoad(t *testing.T) {
+	srv := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	// The first client finds no cache file, so it fetches and saves one.
+	_, err := newCachedClient(t, srv, path).Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Devices) != 4 || len(snap.VirtualButtons) != 4 || snap.Host != srv.Host {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+
+	// The next one only checks the project revision before using it.
+	skip := len(srv.Requests())
+	c := newCachedClient(t, srv, path)
+	device, err := c.Device("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vb, err := c.VirtualButton("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := c.ButtonGroup("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Name != "Pendants" || vb.Name != "Movie Night" || group.Parent.Href != "/device/4" {
+		t.Errorf("unexpected lookups: %+v, %+v, %+v", device, vb, group)
+	}
+	if got := reads(srv, skip); len(got) != 1 || got[0] != "/project" {
+		t.Errorf("cached lookups read %v, want only /project", got)
+	}
+}
+
+func TestCacheStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Snapshot)
+	}{
+		{"expired", func(s *Snapshot) { s.FetchedAt = time.Now().Add(-2 * DefaultCacheTTL) }},
+		{"revision", func(s *Snapshot) { s.Revision = "0000000000000000" }},
+		{"host", func(s *Snapshot) { s.Host = "other.local" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			path := filepath.Join(t.TempDir(), "cache.json")
+
+			snap, err := newCachedClient(t, srv, path).RefreshCache()
+			if err != nil {
+				t.Fatal(err)
+			}
+			snap.Devices[1].Name = "Stale"
+			tt.modify(snap)
+			err = snap.Save(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			device, err := newCachedClient(t, srv, path).Device("2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if device.Name != "Pendants" {
+				t.Errorf("served %q from a stale cache", device.Name)
+			}
+
+			snap, err = LoadSnapshot(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snap.Devices[1].Name != "Pendants" || snap.Host != srv.Host || time.Since(snap.FetchedAt) > time.Minute {
+				t.Errorf("stale cache wasn't refreshed: %+v", snap)
+			}
+		})
+	}
+}
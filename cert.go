@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// CertificateExpiryWarning is how close to expiring a certificate has to be
+// before `tron cert show` warns about it.
+const CertificateExpiryWarning = 30 * 24 * time.Hour
+
+// CertificateInfo describes a certificate tron uses to talk to a controller.
+type CertificateInfo struct {
+	Path string
+
+	Subject     string
+	Issuer      string
+	NotBefore   time.Time
+	NotAfter    time.Time
+	Fingerprint string // SHA-256
+}
+
+// ExpiresWithin reports whether the certificate expires in less than d.
+func (i CertificateInfo) ExpiresWithin(d time.Duration) bool {
+	return time.Until(i.NotAfter) < d
+}
+
+// LoadCertificateInfo reads the first certificate in the PEM file at path.
+func LoadCertificateInfo(path string) (CertificateInfo, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return CertificateInfo{}, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return CertificateInfo{}, fmt.Errorf("no certificate found in %s", path)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return CertificateInfo{}, err
+	}
+
+	return CertificateInfo{
+		Path:        path,
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		Fingerprint: Fingerprint(cert.Raw),
+	}, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER-encoded certificate,
+// as colon-separated hex.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// Identity is a paired client: its private key and certificate, and the
+// controller's CA certificate.
+type Identity struct {
+	Key  crypto.PrivateKey
+	Cert *x509.Certificate
+	CA   []*x509.Certificate
+}
+
+// LoadIdentity reads the client's identity from its certificate paths.
+func (c *Client) LoadIdentity() (Identity, error) {
+	cert, err := c.loadClientCertificate()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return Identity{}, err
+	}
+
+	raw, err := os.ReadFile(c.CACertPath)
+	if err != nil {
+		return Identity{}, err
+	}
+	ca, err := parseCertificates(raw)
+	if err != nil {
+		return Identity{}, err
+	}
+	if len(ca) == 0 {
+		return Identity{}, fmt.Errorf("no certificates found in %s", c.CACertPath)
+	}
+
+	return Identity{Key: cert.PrivateKey, Cert: leaf, CA: ca}, nil
+}
+
+// SaveIdentity replaces the client's key and certificates with id. The files
+// are only replaced once all of them have been written.
+func (c *Client) SaveIdentity(id Identity) error {
+	key, err := encodeKey(id.Key)
+	if err != nil {
+		return err
+	}
+
+	ca := []byte{}
+	for _, cert := range id.CA {
+		ca = append(ca, encodeCertificate(cert)...)
+	}
+
+	return writeFilesAtomic([]fileWrite{
+		{Path: c.ClientKeyPath, Data: key, Perm: 0600},
+		{Path: c.ClientCertPath, Data: encodeCertificate(id.Cert), Perm: 0644},
+		{Path: c.CACertPath, Data: ca, Perm: 0644},
+	})
+}
+
+// EncodePEM bundles the identity into a single PEM file: the key, then the
+// client certificate, then the CA certificates.
+func (id Identity) EncodePEM() ([]byte, error) {
+	key, err := encodeKey(id.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(key)
+	buf.Write(encodeCertificate(id.Cert))
+	for _, cert := range id.CA {
+		buf.Write(encodeCertificate(cert))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// EncodePKCS12 bundles the identity into a PKCS#12 file. Legacy encryption is
+// weaker, but can be read by older tools (e.g. macOS Keychain and OpenSSL 1.x).
+func (id Identity) EncodePKCS12(password string, legacy bool) ([]byte, error) {
+	encoder := pkcs12.Modern
+	if legacy {
+		encoder = pkcs12.Legacy
+	}
+
+	return encoder.Encode(id.Key, id.Cert, id.CA, password)
+}
+
+// DecodeIdentity reads an identity from a PKCS#12 file, or from one or more PEM
+// files holding the key and certificates in any order (like the
+// `caseta.key`, `caseta.crt` and `caseta-bridge.crt` files written by
+// pylutron-caseta). The client certificate is the one matching the key; the
+// rest are taken to be the controller's CA.
+func DecodeIdentity(files [][]byte, password string) (Identity, error) {
+	if len(files) == 1 && !bytes.Contains(files[0], []byte("-----BEGIN")) {
+		key, cert, ca, err := pkcs12.DecodeChain(files[0], password)
+		if err != nil {
+			return Identity{}, err
+		}
+		if len(ca) == 0 {
+			return Identity{}, errors.New("no CA certificate found")
+		}
+		return Identity{Key: key, Cert: cert, CA: ca}, nil
+	}
+
+	var key crypto.PrivateKey
+	certs := []*x509.Certificate{}
+	for _, raw := range files {
+		for {
+			var block *pem.Block
+			block, raw = pem.Decode(raw)
+			if block == nil {
+				break
+			}
+
+			switch {
+			case block.Type == "CERTIFICATE":
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return Identity{}, err
+				}
+				certs = append(certs, cert)
+			case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+				if key != nil {
+					return Identity{}, errors.New("more than one private key found")
+				}
+				var err error
+				key, err = decodeKey(block)
+				if err != nil {
+					return Identity{}, err
+				}
+			}
+		}
+	}
+
+	if key == nil {
+		return Identity{}, errors.New("no private key found")
+	}
+
+	id := Identity{Key: key, CA: []*x509.Certificate{}}
+	for _, cert := range certs {
+		if id.Cert == nil && matchesKey(cert, key) {
+			id.Cert = cert
+		} else {
+			id.CA = append(id.CA, cert)
+		}
+	}
+	if id.Cert == nil {
+		return Identity{}, errors.New("no certificate matching the private key found")
+	}
+	if len(id.CA) == 0 {
+		return Identity{}, errors.New("no CA certificate found")
+	}
+
+	return id, nil
+}
+
+func matchesKey(cert *x509.Certificate, key crypto.PrivateKey) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+func decodeKey(block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+// encodeKey encodes RSA keys as PKCS#1, like Pair does, and other keys as
+// PKCS#8.
+func encodeKey(key crypto.PrivateKey) ([]byte, error) {
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func parseCertificates(raw []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// VerifyIdentity connects to the controller with the client's certificate,
+// checking the controller's certificate against the CA, and pings it to make
+// sure the controller accepts ours. It returns the negotiated connection
+// state.
+func (c *Client) VerifyIdentity() (tls.ConnectionState, error) {
+	return c.VerifyIdentityContext(context.Background())
+}
+
+// VerifyIdentityContext is like VerifyIdentity but uses the provided context.
+func (c *Client) VerifyIdentityContext(ctx context.Context) (tls.ConnectionState, error) {
+	sess, err := c.session(ctx)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+
+	_, err = c.PingContext(ctx)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+
+	conn, ok := sess.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, errors.New("not connected over TLS")
+	}
+
+	return conn.ConnectionState(), nil
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", version)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -9,13 +10,17 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -26,15 +31,54 @@ const pairingPort = 8083
 type Client struct {
 	Host string
 
+	// ControlPort and PairingPort override the controller's standard ports
+	// (8081 and 8083) when non-zero.
+	ControlPort int
+	PairingPort int
+
 	CACertPath     string
 	ClientCertPath string
 	ClientKeyPath  string
 
+	// Insecure skips verifying the controller's certificate against the CA
+	// saved when pairing.
+	Insecure bool
+
+	// CachePath is where the project topology snapshot is cached. If empty,
+	// every lookup goes to the controller.
+	CachePath string
+	CacheTTL  time.Duration
+
 	Verbose bool
 
-	conn  *tls.Conn
-	r     *bufio.Reader
-	seqNo int // instead of UUIDs
+	// Recorder, if set, records the communiques exchanged with the
+	// controller.
+	Recorder *Recorder
+
+	// Replay, if set, answers requests from a recording instead of
+	// connecting to the controller.
+	Replay *Replay
+
+	// Reconnect, if set, makes the client reconnect in the background when
+	// its connection to the controller drops, and re-issue its
+	// subscriptions. Requests in flight when it drops still fail with
+	// ErrSessionClosed.
+	Reconnect *ReconnectPolicy
+
+	mu            sync.Mutex
+	sess          *session
+	reconnectStop chan struct{} // closed to stop supervising the session
+
+	subsMu sync.Mutex
+	subs   map[*subscription]bool // subscriptions to re-issue on reconnect
+
+	zonesMu sync.Mutex
+	zones   map[string]ZoneDefinition // by href
+
+	cacheLoadMu  sync.Mutex // serializes loading the cache file
+	cacheMu      sync.Mutex
+	cacheChecked bool
+	snapshot     *Snapshot
 }
 
 type Request struct {
@@ -66,7 +110,13 @@ type HrefObject struct {
 	Href string `json:"href"`
 }
 
-func (c Client) loadClientCertificate() (tls.Certificate, error) {
+// idFromHref returns the last path component of an href, e.g. "12" for
+// "/zone/12".
+func idFromHref(href string) string {
+	return path.Base(href)
+}
+
+func (c *Client) loadClientCertificate() (tls.Certificate, error) {
 	clientCert, err := os.ReadFile(c.ClientCertPath)
 	if err != nil {
 		return tls.Certificate{}, err
@@ -83,63 +133,243 @@ func (c Client) loadClientCertificate() (tls.Certificate, error) {
 	return cert, nil
 }
 
-func (c *Client) dial() error {
+func (c *Client) loadCACertificate() (*x509.CertPool, error) {
+	caCert, err := os.ReadFile(c.CACertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", c.CACertPath)
+	}
+
+	return roots, nil
+}
+
+// verifyController returns a TLS verifier that checks the controller's
+// certificate chain against roots. Controllers identify themselves by serial
+// number rather than by the hostname or IP address we dial, so the name in
+// the certificate isn't checked.
+func (c *Client) verifyController(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return &CertificateChangedError{Host: c.Host, CACertPath: c.CACertPath, Err: errors.New("no certificate presented")}
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return &CertificateChangedError{Host: c.Host, CACertPath: c.CACertPath, Err: err}
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return &CertificateChangedError{Host: c.Host, CACertPath: c.CACertPath, Err: err}
+		}
+
+		return nil
+	}
+}
+
+// address returns the address to dial for the given port. If the system
+// resolver can't find a `.local` host, it is resolved with multicast DNS.
+func (c *Client) address(ctx context.Context, port int) (string, error) {
+	if c.Host == "" {
+		return "", errors.New("no host configured")
+	}
+
+	if isLocalHost(c.Host) {
+		_, err := net.DefaultResolver.LookupHost(ctx, c.Host)
+		if err != nil {
+			addrs, err := LookupMDNSContext(ctx, c.Host, DefaultDiscoveryTimeout)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve %s: %w", c.Host, err)
+			}
+			if c.Verbose {
+				os.Stderr.WriteString(fmt.Sprintf("Resolved %s with mDNS: %s\n", c.Host, addrs[0]))
+			}
+			return net.JoinHostPort(addrs[0], strconv.Itoa(port)), nil
+		}
+	}
+
+	return net.JoinHostPort(c.Host, strconv.Itoa(port)), nil
+}
+
+func portOrDefault(port int, def int) int {
+	if port == 0 {
+		return def
+	}
+	return port
+}
+
+func (c *Client) dial(ctx context.Context) (*tls.Conn, error) {
 	cert, err := c.loadClientCertificate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	c.conn, err = tls.Dial("tcp", fmt.Sprintf("%s:%d", c.Host, controlPort), &tls.Config{
+	addr, err := c.address(ctx, portOrDefault(c.ControlPort, controlPort))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
 		InsecureSkipVerify: true,
 		Certificates:       []tls.Certificate{cert},
-	})
-	if err != nil {
-		return err
+	}
+	if !c.Insecure {
+		roots, err := c.loadCACertificate()
+		if err != nil {
+			return nil, err
+		}
+		config.VerifyPeerCertificate = c.verifyController(roots)
 	}
 
-	c.r = bufio.NewReader(c.conn)
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return conn.(*tls.Conn), nil
 }
 
-func (c *Client) dialPairing() error {
+// dialPairing connects to the pairing port. The controller's CA isn't known
+// until pairing succeeds, so its certificate can't be verified.
+func (c *Client) dialPairing(ctx context.Context) (*tls.Conn, error) {
+	if c.Replay != nil {
+		return nil, errors.New("can't pair while replaying a recording")
+	}
+
 	cert, err := c.loadPairingCertificate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	c.conn, err = tls.Dial("tcp", fmt.Sprintf("%s:%d", c.Host, pairingPort), &tls.Config{
-		InsecureSkipVerify: true,
-		Certificates:       []tls.Certificate{cert},
-	})
+	addr, err := c.address(ctx, portOrDefault(c.PairingPort, pairingPort))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	c.r = bufio.NewReader(c.conn)
+	dialer := &tls.Dialer{
+		Config: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{cert},
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return conn.(*tls.Conn), nil
 }
 
-func (c *Client) Close() error {
-	return c.conn.Close()
+// session returns the client's persistent session, dialing the controller if
+// there is no live one. The session is shared by all requests until Close is
+// called or the connection drops.
+//
+// With a reconnect policy, every new session is reported as Connected and
+// gets the client's subscriptions re-issued on it, whether it was dialed by
+// the supervisor or by an ordinary request that found the last one dead.
+func (c *Client) session(ctx context.Context) (*session, error) {
+	sess, dialed, err := c.connect(ctx)
+	if dialed && c.Reconnect != nil {
+		c.Reconnect.emit(ConnectionEvent{State: Connected})
+		go c.resubscribeSession(c.Reconnect, sess)
+	}
+
+	return sess, err
 }
 
-func (c *Client) generateClientTag() string {
-	return uuid.NewString()
+// connect returns the live session, or starts a new one and reports that it
+// did. With a reconnect policy, new sessions are supervised.
+func (c *Client) connect(ctx context.Context) (*session, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sess != nil && c.sess.alive() {
+		return c.sess, false, nil
+	}
+
+	if c.Replay != nil {
+		conn := c.Replay.dial()
+		c.sess = newSession(conn, bufio.NewReader(conn), c.Verbose, c.Recorder)
+	} else {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+
+		c.sess = newSession(conn, bufio.NewReader(conn), c.Verbose, c.Recorder)
+	}
+
+	if c.Reconnect != nil && c.reconnectStop == nil {
+		c.reconnectStop = make(chan struct{})
+		go c.superviseConnection(c.Reconnect, c.reconnectStop)
+	}
+
+	return c.sess, true, nil
 }
 
-func (c *Client) send(message []byte) error {
+// roundTrip sends a request over the client's session and waits for the
+// response carrying the same `ClientTag`.
+func (c *Client) roundTrip(ctx context.Context, req Request) (Response, error) {
+	sess, err := c.session(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return sess.roundTrip(ctx, req)
+}
+
+// Close closes the client's connection to the controller, if any. It stops
+// reconnecting, and closes the channels of subscriptions made with a
+// reconnect policy.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.reconnectStop != nil {
+		close(c.reconnectStop)
+		c.reconnectStop = nil
+	}
+	sess := c.sess
+	c.sess = nil
+	c.mu.Unlock()
+
+	// Stop forwarding first, so no subscriber is left blocking the session.
+	c.endSubscriptions()
+
+	if sess != nil {
+		return sess.close()
+	}
+	return nil
+}
+
+// send writes a message to a connection outside of a session.
+func (c *Client) send(conn net.Conn, message []byte) error {
 	if c.Verbose {
 		os.Stderr.WriteString(fmt.Sprintln("===>", string(message)))
 	}
 
-	_, err := c.conn.Write(message)
+	_, err := conn.Write(message)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.conn.Write([]byte("\n"))
+	_, err = conn.Write([]byte("\n"))
 	if err != nil {
 		return err
 	}
@@ -147,8 +377,9 @@ func (c *Client) send(message []byte) error {
 	return nil
 }
 
-func (c *Client) readLine() (string, error) {
-	line, err := c.r.ReadString('\n')
+// readLine reads a message from a connection outside of a session.
+func (c *Client) readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
 	if err != nil {
 		return line, err
 	}
@@ -222,23 +453,44 @@ uHnNjMTXCVxNy4tkARwLRwI+1aV5PMzFSi+HyuWmBaWOe19uz3SFbYs=
 	return cert, nil
 }
 
-// Pair pairs with a Lutron Caséta LEAP controller. This requires the user to
-// press the pairing button on the controller. After pairing, the client
-// certificate is written to the config file.
-func (c *Client) Pair() error {
-	err := c.dialPairing()
-	if err != nil {
-		return err
-	}
-	// May as well clean up, since the connection can't be reused due to
-	// the deadline
-	defer c.Close()
+// PairOptions identifies tron to the controller when pairing. The controller
+// lists paired clients by DisplayName.
+type PairOptions struct {
+	DisplayName string // default "tron"
+	DeviceUID   string // default "000000000000"
+	Role        string // default "Admin"
 
-	// NOTE(ptr): Setting a deadline prevents the connection from being
-	// reused
-	err = c.conn.SetDeadline(time.Now().Add(2 * time.Minute))
-	if err != nil {
-		return err
+	// Timeout is how long to wait for the button to be pressed and the
+	// controller to sign the certificate. The default is two minutes.
+	Timeout time.Duration
+}
+
+// ErrPairingTimeout is returned when the controller's button isn't pressed in
+// time to pair.
+var ErrPairingTimeout = errors.New("timed out waiting for the button press")
+
+// Pair asks the controller to sign a new client certificate, which requires
+// pressing the button on the back of the controller. The key and certificates
+// are only written once the controller has signed the certificate, so a
+// failed attempt leaves any existing pairing intact. The new identity is
+// checked with a Ping before Pair returns.
+func (c *Client) Pair(options PairOptions) error {
+	return c.PairContext(context.Background(), options)
+}
+
+// PairContext is like Pair but uses the provided context.
+func (c *Client) PairContext(ctx context.Context, options PairOptions) error {
+	if options.DisplayName == "" {
+		options.DisplayName = "tron"
+	}
+	if options.DeviceUID == "" {
+		options.DeviceUID = "000000000000"
+	}
+	if options.Role == "" {
+		options.Role = "Admin"
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 2 * time.Minute
 	}
 
 	type PairRequestParameters struct {
@@ -258,43 +510,21 @@ func (c *Client) Pair() error {
 		Header RequestHeader
 	}
 
-	clientCertDir := path.Dir(c.ClientCertPath)
-	err = os.MkdirAll(clientCertDir, 0755)
-	if err != nil {
-		return err
-	}
-
-	clientKeyDir := path.Dir(c.ClientKeyPath)
-	err = os.MkdirAll(clientKeyDir, 0755)
-	if err != nil {
-		return err
-	}
-
-	caCertDir := path.Dir(c.ClientCertPath)
-	err = os.MkdirAll(caCertDir, 0755)
-	if err != nil {
-		return err
+	type SigningResult struct {
+		Certificate     string
+		RootCertificate string
 	}
 
 	priv, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return err
 	}
-
-	// TODO: configure file path
-	w, err := os.OpenFile(c.ClientKeyPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
-	if err != nil {
-		return err
-	}
-	err = pem.Encode(w, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
-	if err != nil {
-		return err
-	}
+	key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
 
 	csrCert, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
 		SignatureAlgorithm: x509.SHA256WithRSA,
 		Subject: pkix.Name{
-			CommonName: "tron",
+			CommonName: options.DisplayName,
 		},
 	}, priv)
 	if err != nil {
@@ -306,13 +536,90 @@ func (c *Client) Pair() error {
 		Bytes: csrCert,
 	})
 
-	fmt.Println("Push the button on the back of your controller...")
+	// The pairing connection can't be reused for requests, so it is kept
+	// apart from the client's session and closed as soon as we're done.
+	conn, err := c.dialPairing(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
 
-	line, err := c.readLine()
+	deadline := time.Now().Add(options.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err = conn.SetDeadline(deadline)
 	if err != nil {
 		return err
 	}
 
+	// Cancelling ctx interrupts the wait for the button.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	// read returns the next message from the controller, turning exceptions
+	// into errors.
+	read := func() (Response, error) {
+		line, err := c.readLine(r)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if ctx.Err() != nil {
+					return Response{}, ctx.Err()
+				}
+				return Response{}, ErrPairingTimeout
+			}
+			return Response{}, err
+		}
+
+		var res Response
+		err = json.Unmarshal([]byte(line), &res)
+		if err != nil {
+			return Response{}, err
+		}
+
+		code, _ := parseStatus(res.Header.StatusCode)
+		if res.CommuniqueType == "ExceptionResponse" || res.Header.MessageBodyType == "ExceptionDetail" || code >= 300 {
+			return Response{}, newLEAPError(res)
+		}
+
+		return res, nil
+	}
+
+	fmt.Println("Push the button on the back of your controller...")
+
+	// The controller reports the client's permissions when it connects, and
+	// again with PhysicalAccess once the button is pressed.
+	for pressed := false; !pressed; {
+		res, err := read()
+		if err != nil {
+			return err
+		}
+
+		var status struct {
+			Status struct {
+				Permissions []string
+			}
+		}
+		err = mapstructure.Decode(res.Body, &status)
+		if err != nil {
+			return err
+		}
+		for _, permission := range status.Status.Permissions {
+			if permission == "PhysicalAccess" {
+				pressed = true
+			}
+		}
+	}
+
 	req := PairRequest{
 		Header: RequestHeader{
 			RequestType: "Execute",
@@ -323,9 +630,9 @@ func (c *Client) Pair() error {
 			CommandType: "CSR",
 			Parameters: PairRequestParameters{
 				CSR:         string(csr),
-				DeviceUID:   "000000000000",
-				DisplayName: "tron",
-				Role:        "Admin",
+				DeviceUID:   options.DeviceUID,
+				DisplayName: options.DisplayName,
+				Role:        options.Role,
 			},
 		},
 	}
@@ -335,153 +642,319 @@ func (c *Client) Pair() error {
 		return err
 	}
 
-	err = c.send(msg)
+	err = c.send(conn, msg)
 	if err != nil {
 		return err
 	}
 
-	line, err = c.readLine()
-	if err != nil {
-		return err
-	}
+	var result SigningResult
+	for {
+		res, err := read()
+		if err != nil {
+			return err
+		}
+		if res.Header.ClientTag != "pair" {
+			continue
+		}
 
-	type PairResponse struct {
-		Body struct {
-			SigningResult struct {
-				Certificate     string
-				RootCertificate string
-			}
+		var body struct {
+			SigningResult SigningResult
+		}
+		err = mapstructure.Decode(res.Body, &body)
+		if err != nil {
+			return err
 		}
+		result = body.SigningResult
+		break
 	}
 
-	var res PairResponse
-	err = json.Unmarshal([]byte(line), &res)
+	if result.Certificate == "" || result.RootCertificate == "" {
+		return errors.New("controller did not return a signed certificate")
+	}
+	_, err = tls.X509KeyPair([]byte(result.Certificate), key)
 	if err != nil {
-		return err
+		return fmt.Errorf("controller returned an invalid certificate: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(result.RootCertificate)) {
+		return errors.New("controller returned an invalid CA certificate")
 	}
 
-	err = os.WriteFile(c.ClientCertPath, []byte(res.Body.SigningResult.Certificate), 0644)
+	err = writeFilesAtomic([]fileWrite{
+		{Path: c.ClientKeyPath, Data: key, Perm: 0600},
+		{Path: c.ClientCertPath, Data: []byte(result.Certificate), Perm: 0644},
+		{Path: c.CACertPath, Data: []byte(result.RootCertificate), Perm: 0644},
+	})
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(c.CACertPath, []byte(res.Body.SigningResult.RootCertificate), 0644)
+	c.Close()
+
+	_, err = c.PingContext(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("paired, but failed to connect with the new certificate: %w", err)
 	}
 
 	return nil
 }
 
-// Get sends a `ReadRequest` communique to the controller.
-func (c *Client) Get(path string) (map[string]any, error) {
-	fail := func(err error) (map[string]any, error) { return map[string]any{}, err }
+type fileWrite struct {
+	Path string
+	Data []byte
+	Perm os.FileMode
+}
 
-	err := c.dial()
-	if err != nil {
-		return fail(err)
+// rename is os.Rename, replaceable in tests.
+var rename = os.Rename
+
+// writeFilesAtomic writes each file to a temporary file alongside it, and only
+// once all of them are written renames them into place. The files they
+// replace are moved aside first, and put back if any rename fails, so either
+// all of the files are replaced or none are.
+func writeFilesAtomic(files []fileWrite) error {
+	tmps := []string{}
+	cleanup := func() {
+		for _, tmp := range tmps {
+			os.Remove(tmp)
+		}
 	}
-	defer c.Close()
-
-	tag := c.generateClientTag()
 
-	req := Request{
-		CommuniqueType: "ReadRequest",
-		Header: RequestHeader{
-			ClientTag: tag,
-			URL:       path,
-		},
-	}
+	for _, f := range files {
+		err := os.MkdirAll(filepath.Dir(f.Path), 0755)
+		if err != nil {
+			cleanup()
+			return err
+		}
 
-	msg, err := json.Marshal(req)
-	if err != nil {
-		return fail(err)
+		tmp := f.Path + ".tmp"
+		err = os.WriteFile(tmp, f.Data, f.Perm)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		tmps = append(tmps, tmp)
 	}
 
-	err = c.send(msg)
-	if err != nil {
-		return fail(err)
+	backups := make([]string, len(files))
+	installed := make([]bool, len(files))
+	rollback := func() {
+		for i, f := range files {
+			if installed[i] {
+				os.Remove(f.Path)
+			}
+			if backups[i] != "" {
+				rename(backups[i], f.Path)
+			}
+		}
+		cleanup()
 	}
 
-	for {
-		line, err := c.readLine()
+	for i, f := range files {
+		_, err := os.Lstat(f.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
 		if err != nil {
-			return fail(err)
+			rollback()
+			return err
 		}
 
-		var res Response
-		err = json.Unmarshal([]byte(line), &res)
+		backup := f.Path + ".old"
+		err = rename(f.Path, backup)
 		if err != nil {
-			return fail(err)
+			rollback()
+			return err
 		}
+		backups[i] = backup
+	}
 
-		if res.CommuniqueType == "ExceptionResponse" && res.Header.ClientTag == tag {
-			return fail(fmt.Errorf("received %s: %s", res.Header.StatusCode, res.Body["Message"]))
+	for i, f := range files {
+		err := rename(tmps[i], f.Path)
+		if err != nil {
+			rollback()
+			return err
 		}
-		if res.CommuniqueType == "ReadResponse" && res.Header.ClientTag == tag {
-			if res.Header.StatusCode == "200 OK" {
-				return res.Body, nil
-			} else {
-				return fail(fmt.Errorf("received %s status", res.Header.StatusCode))
-			}
+		installed[i] = true
+	}
+
+	for _, backup := range backups {
+		if backup != "" {
+			os.Remove(backup)
 		}
 	}
+
+	return nil
 }
 
-// Post sends a `CreateRequest` communique to the controller.
-func (c *Client) Post(path string, payload any) (map[string]any, error) {
-	fail := func(err error) (map[string]any, error) { return map[string]any{}, err }
+// exchanges maps each request's communique type to the type of its response.
+// Any 2xx status means the request succeeded: controllers don't agree on
+// which one each request gets, e.g. deletes are answered with 200 or 204.
+var exchanges = map[string]string{
+	"ReadRequest":      "ReadResponse",
+	"CreateRequest":    "CreateResponse",
+	"UpdateRequest":    "UpdateResponse",
+	"DeleteRequest":    "DeleteResponse",
+	"SubscribeRequest": "SubscribeResponse",
+}
 
-	err := c.dial()
+// parseStatus splits a LEAP status (e.g. `404 NotFound`) into its code and
+// text.
+func parseStatus(status string) (int, string) {
+	code, text, _ := strings.Cut(status, " ")
+	n, err := strconv.Atoi(code)
 	if err != nil {
-		return fail(err)
+		return 0, status
+	}
+	return n, text
+}
+
+// checkResponse verifies that res is the successful reply to a request of the
+// given communique type. Failures reported by the controller are returned as
+// a *LEAPError.
+func checkResponse(communiqueType string, res Response) error {
+	if res.CommuniqueType == "ExceptionResponse" {
+		return newLEAPError(res)
+	}
+
+	if res.CommuniqueType != exchanges[communiqueType] {
+		return fmt.Errorf("received unexpected %s", res.CommuniqueType)
+	}
+	if code, _ := parseStatus(res.Header.StatusCode); code < 200 || code > 299 {
+		return newLEAPError(res)
 	}
-	defer c.Close()
 
-	tag := c.generateClientTag()
+	return nil
+}
+
+// Do sends a communique of the given type to the controller and returns the
+// body of the response. Supported types are `ReadRequest`, `CreateRequest`,
+// `UpdateRequest` and `DeleteRequest`; the response must have the matching
+// type and a 2xx status. Rejections are returned as a *LEAPError.
+func (c *Client) Do(communiqueType string, path string, body any) (map[string]any, error) {
+	return c.DoContext(context.Background(), communiqueType, path, body)
+}
+
+// DoContext is like Do but uses the provided context. The context bounds
+// connecting to the controller, including the TLS handshake, and waiting for
+// the response; once it is done, the request is abandoned and its error is
+// returned.
+func (c *Client) DoContext(ctx context.Context, communiqueType string, path string, body any) (map[string]any, error) {
+	fail := func(err error) (map[string]any, error) { return map[string]any{}, err }
+
+	if _, ok := exchanges[communiqueType]; !ok || communiqueType == "SubscribeRequest" {
+		return fail(fmt.Errorf("unsupported communique type %q", communiqueType))
+	}
 
 	req := Request{
-		CommuniqueType: "CreateRequest",
+		CommuniqueType: communiqueType,
 		Header: RequestHeader{
-			ClientTag: tag,
-			URL:       path,
+			URL: path,
 		},
-		Body: payload,
+		Body: body,
 	}
 
-	msg, err := json.Marshal(req)
+	res, err := c.roundTrip(ctx, req)
 	if err != nil {
 		return fail(err)
 	}
 
-	err = c.send(msg)
+	err = checkResponse(communiqueType, res)
 	if err != nil {
 		return fail(err)
 	}
 
-	for {
-		line, err := c.readLine()
-		if err != nil {
-			return fail(err)
-		}
+	if res.Body == nil {
+		return map[string]any{}, nil
+	}
 
-		var res Response
-		err = json.Unmarshal([]byte(line), &res)
-		if err != nil {
-			return fail(err)
-		}
+	return res.Body, nil
+}
 
-		if res.CommuniqueType == "ExceptionResponse" && res.Header.ClientTag == tag {
-			return fail(fmt.Errorf("received %s: %s", res.Header.StatusCode, res.Body["Message"]))
-		}
-		if res.CommuniqueType == "CreateResponse" && res.Header.ClientTag == tag {
-			if res.Header.StatusCode == "201 Created" {
-				return res.Body, nil
-			} else {
-				return fail(fmt.Errorf("received %s status", res.Header.StatusCode))
-			}
-		}
+// Get sends a `ReadRequest` communique to the controller.
+func (c *Client) Get(path string) (map[string]any, error) {
+	return c.GetContext(context.Background(), path)
+}
+
+// GetContext is like Get but uses the provided context.
+func (c *Client) GetContext(ctx context.Context, path string) (map[string]any, error) {
+	return c.DoContext(ctx, "ReadRequest", path, nil)
+}
+
+// Post sends a `CreateRequest` communique to the controller.
+func (c *Client) Post(path string, payload any) (map[string]any, error) {
+	return c.PostContext(context.Background(), path, payload)
+}
+
+// PostContext is like Post but uses the provided context.
+func (c *Client) PostContext(ctx context.Context, path string, payload any) (map[string]any, error) {
+	return c.DoContext(ctx, "CreateRequest", path, payload)
+}
+
+// Put sends an `UpdateRequest` communique to the controller.
+func (c *Client) Put(path string, payload any) (map[string]any, error) {
+	return c.PutContext(context.Background(), path, payload)
+}
+
+// PutContext is like Put but uses the provided context.
+func (c *Client) PutContext(ctx context.Context, path string, payload any) (map[string]any, error) {
+	return c.DoContext(ctx, "UpdateRequest", path, payload)
+}
+
+// Delete sends a `DeleteRequest` communique to the controller.
+func (c *Client) Delete(path string) (map[string]any, error) {
+	return c.DeleteContext(context.Background(), path)
+}
+
+// DeleteContext is like Delete but uses the provided context.
+func (c *Client) DeleteContext(ctx context.Context, path string) (map[string]any, error) {
+	return c.DoContext(ctx, "DeleteRequest", path, nil)
+}
+
+// Subscribe sends a `SubscribeRequest` communique to the controller. The
+// returned channel receives the controller's acknowledgement followed by every
+// update it pushes for the path, and is closed when the connection ends.
+// Updates the caller hasn't read yet are queued without limit, rather than
+// stalling other requests, so callers should keep draining the channel until
+// it is closed.
+//
+// With a reconnect policy, the channel instead stays open when the connection
+// drops. The subscription is re-issued once the client reconnects, and the
+// new acknowledgement (with the current state) is delivered like the first.
+// The channel is closed by Close, or when the policy gives up.
+func (c *Client) Subscribe(path string) (<-chan Response, error) {
+	return c.SubscribeContext(context.Background(), path)
+}
+
+// SubscribeContext is like Subscribe but uses the provided context.
+func (c *Client) SubscribeContext(ctx context.Context, path string) (<-chan Response, error) {
+	if c.Reconnect != nil {
+		return c.subscribeReconnecting(ctx, path)
+	}
+
+	sess, err := c.session(ctx)
+	if err != nil {
+		return nil, err
 	}
+
+	req := Request{
+		CommuniqueType: "SubscribeRequest",
+		Header: RequestHeader{
+			URL: path,
+		},
+	}
+
+	res, sub, err := sess.subscribe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(req.CommuniqueType, res)
+	if err != nil {
+		sess.unsubscribe(res)
+		return nil, err
+	}
+
+	return sub, nil
 }
 
 type PingResponseBody struct {
@@ -495,7 +968,12 @@ type PingResponse struct {
 // Ping sends a `ping` request to the controller. If no error is returned, the
 // controller responded with a 200 OK status.
 func (c *Client) Ping() (PingResponse, error) {
-	body, err := c.Get("/server/1/status/ping")
+	return c.PingContext(context.Background())
+}
+
+// PingContext is like Ping but uses the provided context.
+func (c *Client) PingContext(ctx context.Context) (PingResponse, error) {
+	body, err := c.GetContext(ctx, "/server/1/status/ping")
 	if err != nil {
 		return PingResponse{}, err
 	}
@@ -537,9 +1015,24 @@ type MultipleDeviceDefinition struct {
 	Devices []DeviceDefinition
 }
 
-// Devices gets the list of devices this controller knows about.
+// Device gets information about the specified device.
 func (c *Client) Device(id string) (DeviceDefinition, error) {
-	body, err := c.Get(fmt.Sprintf("/device/%s", id))
+	return c.DeviceContext(context.Background(), id)
+}
+
+// DeviceContext is like Device but uses the provided context.
+func (c *Client) DeviceContext(ctx context.Context, id string) (DeviceDefinition, error) {
+	href := fmt.Sprintf("/device/%s", id)
+
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		for _, device := range snap.Devices {
+			if device.Href == href {
+				return device, nil
+			}
+		}
+	}
+
+	body, err := c.GetContext(ctx, href)
 	if err != nil {
 		return DeviceDefinition{}, err
 	}
@@ -555,7 +1048,20 @@ func (c *Client) Device(id string) (DeviceDefinition, error) {
 
 // Devices gets the list of devices this controller knows about.
 func (c *Client) Devices() ([]DeviceDefinition, error) {
-	body, err := c.Get("/device")
+	return c.DevicesContext(context.Background())
+}
+
+// DevicesContext is like Devices but uses the provided context.
+func (c *Client) DevicesContext(ctx context.Context) ([]DeviceDefinition, error) {
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		return snap.Devices, nil
+	}
+
+	return c.fetchDevices(ctx)
+}
+
+func (c *Client) fetchDevices(ctx context.Context) ([]DeviceDefinition, error) {
+	body, err := c.GetContext(ctx, "/device")
 	if err != nil {
 		return []DeviceDefinition{}, err
 	}
@@ -595,7 +1101,12 @@ type ServerDefinition struct {
 // Servers gets the list of servers this controller knows about. Typically,
 // this will just return a single entry for the controller we are connected to.
 func (c *Client) Servers() ([]ServerDefinition, error) {
-	body, err := c.Get("/server")
+	return c.ServersContext(context.Background())
+}
+
+// ServersContext is like Servers but uses the provided context.
+func (c *Client) ServersContext(ctx context.Context) ([]ServerDefinition, error) {
+	body, err := c.GetContext(ctx, "/server")
 	if err != nil {
 		return []ServerDefinition{}, err
 	}
@@ -615,7 +1126,12 @@ type OneServerDefinition struct {
 
 // Server gets information about the specified server.
 func (c *Client) Server(id string) (ServerDefinition, error) {
-	body, err := c.Get(fmt.Sprintf("/server/%s", id))
+	return c.ServerContext(context.Background(), id)
+}
+
+// ServerContext is like Server but uses the provided context.
+func (c *Client) ServerContext(ctx context.Context, id string) (ServerDefinition, error) {
+	body, err := c.GetContext(ctx, fmt.Sprintf("/server/%s", id))
 	if err != nil {
 		return ServerDefinition{}, err
 	}
@@ -671,7 +1187,12 @@ type ServiceDefinition struct {
 // Services gets the list of 3rd-party services this controller can interface
 // with.
 func (c *Client) Services() ([]ServiceDefinition, error) {
-	body, err := c.Get("/service")
+	return c.ServicesContext(context.Background())
+}
+
+// ServicesContext is like Services but uses the provided context.
+func (c *Client) ServicesContext(ctx context.Context) ([]ServiceDefinition, error) {
+	body, err := c.GetContext(ctx, "/service")
 	if err != nil {
 		return []ServiceDefinition{}, err
 	}
@@ -712,7 +1233,20 @@ type OneAreaDefinition struct {
 
 // Areas gets the list of areas defined on this controller.
 func (c *Client) Areas() ([]AreaDefinition, error) {
-	body, err := c.Get("/area")
+	return c.AreasContext(context.Background())
+}
+
+// AreasContext is like Areas but uses the provided context.
+func (c *Client) AreasContext(ctx context.Context) ([]AreaDefinition, error) {
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		return snap.Areas, nil
+	}
+
+	return c.fetchAreas(ctx)
+}
+
+func (c *Client) fetchAreas(ctx context.Context) ([]AreaDefinition, error) {
+	body, err := c.GetContext(ctx, "/area")
 	if err != nil {
 		return []AreaDefinition{}, err
 	}
@@ -728,7 +1262,22 @@ func (c *Client) Areas() ([]AreaDefinition, error) {
 
 // Area gets information about the specified area.
 func (c *Client) Area(id string) (AreaDefinition, error) {
-	body, err := c.Get(fmt.Sprintf("/area/%s", id))
+	return c.AreaContext(context.Background(), id)
+}
+
+// AreaContext is like Area but uses the provided context.
+func (c *Client) AreaContext(ctx context.Context, id string) (AreaDefinition, error) {
+	href := fmt.Sprintf("/area/%s", id)
+
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		for _, area := range snap.Areas {
+			if area.Href == href {
+				return area, nil
+			}
+		}
+	}
+
+	body, err := c.GetContext(ctx, href)
 	if err != nil {
 		return AreaDefinition{}, err
 	}
@@ -751,7 +1300,8 @@ type ZoneDefinition struct {
 		IsLight bool
 		Type    string
 	}
-	Device HrefObject
+	AssociatedArea HrefObject
+	Device         HrefObject
 }
 
 type MultipleZoneDefinition struct {
@@ -764,7 +1314,20 @@ type OneZoneDefinition struct {
 
 // Zones gets the list of zones defined on this controller.
 func (c *Client) Zones() ([]ZoneDefinition, error) {
-	body, err := c.Get("/zone")
+	return c.ZonesContext(context.Background())
+}
+
+// ZonesContext is like Zones but uses the provided context.
+func (c *Client) ZonesContext(ctx context.Context) ([]ZoneDefinition, error) {
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		return snap.Zones, nil
+	}
+
+	return c.fetchZones(ctx)
+}
+
+func (c *Client) fetchZones(ctx context.Context) ([]ZoneDefinition, error) {
+	body, err := c.GetContext(ctx, "/zone")
 	if err != nil {
 		return []ZoneDefinition{}, err
 	}
@@ -775,12 +1338,39 @@ func (c *Client) Zones() ([]ZoneDefinition, error) {
 		return []ZoneDefinition{}, err
 	}
 
+	c.rememberZones(res.Zones...)
+
 	return res.Zones, nil
 }
 
-// Zone gets information about the specified zone.
+// Zone gets information about the specified zone. Definitions are served from
+// the cache when it is fresh, and otherwise remembered for the life of the
+// client, so repeated lookups of the same zone (e.g. to check its
+// `ControlType` before sending a command) don't cost a round trip.
 func (c *Client) Zone(id string) (ZoneDefinition, error) {
-	body, err := c.Get(fmt.Sprintf("/zone/%s", id))
+	return c.ZoneContext(context.Background(), id)
+}
+
+// ZoneContext is like Zone but uses the provided context.
+func (c *Client) ZoneContext(ctx context.Context, id string) (ZoneDefinition, error) {
+	href := fmt.Sprintf("/zone/%s", id)
+
+	c.zonesMu.Lock()
+	zone, ok := c.zones[href]
+	c.zonesMu.Unlock()
+	if ok {
+		return zone, nil
+	}
+
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		for _, zone := range snap.Zones {
+			if zone.Href == href {
+				return zone, nil
+			}
+		}
+	}
+
+	body, err := c.GetContext(ctx, href)
 	if err != nil {
 		return ZoneDefinition{}, err
 	}
@@ -791,9 +1381,23 @@ func (c *Client) Zone(id string) (ZoneDefinition, error) {
 		return ZoneDefinition{}, err
 	}
 
+	c.rememberZones(res.Zone)
+
 	return res.Zone, nil
 }
 
+func (c *Client) rememberZones(zones ...ZoneDefinition) {
+	c.zonesMu.Lock()
+	defer c.zonesMu.Unlock()
+
+	if c.zones == nil {
+		c.zones = map[string]ZoneDefinition{}
+	}
+	for _, zone := range zones {
+		c.zones[zone.Href] = zone
+	}
+}
+
 type CommandParameter struct {
 	Type  string
 	Value int
@@ -829,7 +1433,7 @@ type DimOptions struct {
 	Level    int
 }
 
-func (c *Client) zoneGoToLevel(id string, options DimOptions) (ZoneDefinition, error) {
+func (c *Client) zoneGoToLevel(ctx context.Context, id string, options DimOptions) (ZoneDefinition, error) {
 	body := GoToLevelCommandBody{
 		Command: GoToLevelCommand{
 			CommandType: "GoToLevel",
@@ -842,7 +1446,7 @@ func (c *Client) zoneGoToLevel(id string, options DimOptions) (ZoneDefinition, e
 		},
 	}
 
-	raw, err := c.Post(fmt.Sprintf("/zone/%s/commandprocessor", id), body)
+	raw, err := c.PostContext(ctx, fmt.Sprintf("/zone/%s/commandprocessor", id), body)
 	if err != nil {
 		return ZoneDefinition{}, err
 	}
@@ -856,7 +1460,7 @@ func (c *Client) zoneGoToLevel(id string, options DimOptions) (ZoneDefinition, e
 	return res.Zone, nil
 }
 
-func (c *Client) zoneGoToDimmedLevel(id string, options DimOptions) (ZoneDefinition, error) {
+func (c *Client) zoneGoToDimmedLevel(ctx context.Context, id string, options DimOptions) (ZoneDefinition, error) {
 	body := GoToDimmedLevelCommandBody{
 		Command: GoToDimmedLevelCommand{
 			CommandType: "GoToDimmedLevel",
@@ -868,7 +1472,7 @@ func (c *Client) zoneGoToDimmedLevel(id string, options DimOptions) (ZoneDefinit
 		},
 	}
 
-	raw, err := c.Post(fmt.Sprintf("/zone/%s/commandprocessor", id), body)
+	raw, err := c.PostContext(ctx, fmt.Sprintf("/zone/%s/commandprocessor", id), body)
 	if err != nil {
 		return ZoneDefinition{}, err
 	}
@@ -884,19 +1488,114 @@ func (c *Client) zoneGoToDimmedLevel(id string, options DimOptions) (ZoneDefinit
 
 // ZoneDim dims the zone to the provided level.
 func (c *Client) ZoneDim(id string, options DimOptions) (ZoneDefinition, error) {
+	return c.ZoneDimContext(context.Background(), id, options)
+}
+
+// ZoneDimContext is like ZoneDim but uses the provided context.
+func (c *Client) ZoneDimContext(ctx context.Context, id string, options DimOptions) (ZoneDefinition, error) {
 	if options.Delay == "" && options.Duration == "" {
-		return c.zoneGoToLevel(id, options)
+		return c.zoneGoToLevel(ctx, id, options)
 	} else {
-		return c.zoneGoToDimmedLevel(id, options)
+		return c.zoneGoToDimmedLevel(ctx, id, options)
+	}
+}
+
+// ZoneOn turns the zone on, choosing the command that fits its `ControlType`:
+// switched loads are switched on, contact closures are closed, fans go to high
+// and everything else is dimmed to 100. Delay and duration only apply to
+// dimmed zones.
+func (c *Client) ZoneOn(id string, options DimOptions) error {
+	return c.ZoneOnContext(context.Background(), id, options)
+}
+
+// ZoneOnContext is like ZoneOn but uses the provided context.
+func (c *Client) ZoneOnContext(ctx context.Context, id string, options DimOptions) error {
+	return c.zonePower(ctx, id, true, options)
+}
+
+// ZoneOff turns the zone off, choosing the command that fits its
+// `ControlType` (see ZoneOn).
+func (c *Client) ZoneOff(id string, options DimOptions) error {
+	return c.ZoneOffContext(context.Background(), id, options)
+}
+
+// ZoneOffContext is like ZoneOff but uses the provided context.
+func (c *Client) ZoneOffContext(ctx context.Context, id string, options DimOptions) error {
+	return c.zonePower(ctx, id, false, options)
+}
+
+func (c *Client) zonePower(ctx context.Context, id string, on bool, options DimOptions) error {
+	zone, err := c.ZoneContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	switch zone.ControlType {
+	case "Switched":
+		if on {
+			return c.ZoneSwitchContext(ctx, id, SwitchedOn)
+		}
+		return c.ZoneSwitchContext(ctx, id, SwitchedOff)
+	case "CCO":
+		if on {
+			return c.ZoneCCOContext(ctx, id, CCOClosed)
+		}
+		return c.ZoneCCOContext(ctx, id, CCOOpen)
+	case "FanSpeed":
+		if on {
+			return c.ZoneFanSpeedContext(ctx, id, FanSpeedHigh)
+		}
+		return c.ZoneFanSpeedContext(ctx, id, FanSpeedOff)
+	default:
+		options.Level = 0
+		if on {
+			options.Level = 100
+		}
+		_, err := c.ZoneDimContext(ctx, id, options)
+		return err
 	}
 }
 
+// ZoneCommand is a command accepted by a zone's command processor. Only the
+// parameters for the given command type should be set.
+type ZoneCommand struct {
+	CommandType string
+
+	CCOLevelParameters            *CCOLevelParameters            `json:",omitempty"`
+	FanSpeedParameters            *FanSpeedParameters            `json:",omitempty"`
+	ShadeWithTiltLevelParameters  *ShadeWithTiltLevelParameters  `json:",omitempty"`
+	SpectrumTuningLevelParameters *SpectrumTuningLevelParameters `json:",omitempty"`
+	SwitchedLevelParameters       *SwitchedLevelParameters       `json:",omitempty"`
+	TiltParameters                *TiltParameters                `json:",omitempty"`
+	WhiteTuningLevelParameters    *WhiteTuningLevelParameters    `json:",omitempty"`
+}
+
+type ZoneCommandBody struct {
+	Command ZoneCommand
+}
+
+// zoneCommand sends the command to the zone's command processor.
+func (c *Client) zoneCommand(ctx context.Context, id string, command ZoneCommand) error {
+	body := ZoneCommandBody{
+		Command: command,
+	}
+
+	_, err := c.PostContext(ctx, fmt.Sprintf("/zone/%s/commandprocessor", id), body)
+	return err
+}
+
 type ZoneStatus struct {
 	Href string `json:"href"`
 
 	Zone           HrefObject
 	Level          int
+	SwitchedLevel  SwitchedLevel
+	CCOLevel       CCOLevel
+	FanSpeed       FanSpeed
 	StatusAccuracy string
+
+	ColorTuningStatus ColorTuningStatus
+	Vibrancy          int
 }
 
 type OneZoneStatus struct {
@@ -905,7 +1604,12 @@ type OneZoneStatus struct {
 
 // ZoneStatus gets the current status of the zone.
 func (c *Client) ZoneStatus(id string) (ZoneStatus, error) {
-	raw, err := c.Get(fmt.Sprintf("/zone/%s/status", id))
+	return c.ZoneStatusContext(context.Background(), id)
+}
+
+// ZoneStatusContext is like ZoneStatus but uses the provided context.
+func (c *Client) ZoneStatusContext(ctx context.Context, id string) (ZoneStatus, error) {
+	raw, err := c.GetContext(ctx, fmt.Sprintf("/zone/%s/status", id))
 	if err != nil {
 		return ZoneStatus{}, err
 	}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/paulrosania/tron/leaptest"
+)
+
+// newTestServer starts a fake controller serving the fixture project.
+func newTestServer(t *testing.T) *leaptest.Server {
+	t.Helper()
+
+	project, err := leaptest.LoadProject("testdata/project.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := leaptest.NewServer(project)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// newTestClient returns a client already paired with srv.
+func newTestClient(t *testing.T, srv *leaptest.Server) *Client {
+	t.Helper()
+
+	caPath, certPath, keyPath, err := srv.ClientIdentity(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{
+		Host:           srv.Host,
+		ControlPort:    srv.ControlPort,
+		PairingPort:    srv.PairingPort,
+		CACertPath:     caPath,
+		ClientCertPath: certPath,
+		ClientKeyPath:  keyPath,
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestPing(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	res, err := c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.LEAPVersion != leaptest.LEAPVersion {
+		t.Errorf("LEAPVersion = %v, want %v", res.LEAPVersion, leaptest.LEAPVersion)
+	}
+}
+
+func TestPingWrongCA(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	// A client paired with a different controller must refuse this one.
+	other := leaptest.NewServer(nil)
+	defer other.Close()
+	caPath, _, _, err := other.ClientIdentity(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CACertPath = caPath
+
+	_, err = c.Ping()
+	var changed *CertificateChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Ping() error = %v, want a CertificateChangedError", err)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	devices, err := c.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Smart Bridge", "Pendants", "Lamp", "Pico"}
+	if len(devices) != len(want) {
+		t.Fatalf("got %d devices, want %d", len(devices), len(want))
+	}
+	for i, name := range want {
+		if devices[i].Name != name {
+			t.Errorf("devices[%d].Name = %q, want %q", i, devices[i].Name, name)
+		}
+	}
+
+	dimmer := devices[1]
+	if dimmer.Href != "/device/2" || dimmer.DeviceType != "WallDimmer" || dimmer.SerialNumber != 23456789 {
+		t.Errorf("unexpected dimmer: %+v", dimmer)
+	}
+	if len(dimmer.LocalZones) != 1 || dimmer.LocalZones[0].Href != "/zone/1" {
+		t.Errorf("dimmer.LocalZones = %v, want [/zone/1]", dimmer.LocalZones)
+	}
+
+	device, err := c.Device("4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Name != "Pico" || len(device.ButtonGroups) != 1 {
+		t.Errorf("unexpected device: %+v", device)
+	}
+
+	_, err = c.Device("99")
+	if !IsNotFound(err) {
+		t.Errorf("Device(99) error = %v, want 404", err)
+	}
+}
+
+func TestZoneDim(t *testing.T) {
+	tests := []struct {
+		name    string
+		options DimOptions
+		command string
+	}{
+		{"level", DimOptions{Level: 40}, "GoToLevel"},
+		{"fade", DimOptions{Level: 75, Duration: "00:00:02"}, "GoToDimmedLevel"},
+		{"delay", DimOptions{Level: 5, Delay: "00:00:01"}, "GoToDimmedLevel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			c := newTestClient(t, srv)
+
+			_, err := c.ZoneDim("1", tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			level, _ := srv.ZoneLevel("/zone/1")
+			if level != tt.options.Level {
+				t.Errorf("level = %d, want %d", level, tt.options.Level)
+			}
+
+			requests := srv.Requests()
+			last := requests[len(requests)-1]
+			command, _ := last.Body["Command"].(map[string]any)
+			if last.Header.URL != "/zone/1/commandprocessor" || command["CommandType"] != tt.command {
+				t.Errorf("sent %s %v, want %s", last.Header.URL, command["CommandType"], tt.command)
+			}
+		})
+	}
+}
+
+func TestZoneDimUnknownZone(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	_, err := c.ZoneDim("99", DimOptions{Level: 50})
+	if !IsNotFound(err) {
+		t.Errorf("ZoneDim(99) error = %v, want 404", err)
+	}
+}
+
+func TestZoneStatus(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	status, err := c.ZoneStatus("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Zone.Href != "/zone/2" || status.Level != 100 || status.SwitchedLevel != SwitchedOn {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	srv.SetZoneLevel("/zone/1", 60)
+	status, err = c.ZoneStatus("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Level != 60 || status.StatusAccuracy != "Good" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	err = c.ZoneOff("2", DimOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = c.ZoneStatus("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Level != 0 || status.SwitchedLevel != SwitchedOff {
+		t.Errorf("after ZoneOff, status = %+v", status)
+	}
+}
+
+func TestGetContextTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	_, err := c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SetUnresponsive(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = c.GetContext(ctx, "/zone")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetContext() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The session is still usable once the controller answers again.
+	srv.SetUnresponsive(false)
+	_, err = c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialContextTimeout(t *testing.T) {
+	// A controller that accepts connections but never completes the TLS
+	// handshake.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+	c.ControlPort = l.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = c.PingContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PingContext() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSubscribeSlowSubscriber(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	updates, err := c.Subscribe("/zone/1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Push updates without reading them. Other requests must not stall
+	// behind the subscription.
+	for level := 1; level <= 40; level++ {
+		srv.SetZoneLevel("/zone/1", level)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c.PingContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// None of them are lost: the acknowledgement and every update arrive in
+	// order.
+	for level := 0; level <= 40; level++ {
+		expectLevel(t, updates, level)
+	}
+
+	closed := make(chan error)
+	go func() { closed <- c.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() hung")
+	}
+	if _, ok := <-updates; ok {
+		t.Error("subscription still open after Close")
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		request  string
+		response string
+		status   string
+		ok       bool
+	}{
+		{"ReadRequest", "ReadResponse", "200 OK", true},
+		{"CreateRequest", "CreateResponse", "201 Created", true},
+		{"CreateRequest", "CreateResponse", "200 OK", true},
+		{"UpdateRequest", "UpdateResponse", "200 OK", true},
+		{"UpdateRequest", "UpdateResponse", "204 NoContent", true},
+		{"DeleteRequest", "DeleteResponse", "204 NoContent", true},
+		{"DeleteRequest", "DeleteResponse", "200 OK", true},
+		{"DeleteRequest", "DeleteResponse", "404 NotFound", false},
+		{"ReadRequest", "ReadResponse", "300 MultipleChoices", false},
+		{"ReadRequest", "UpdateResponse", "200 OK", false},
+		{"ReadRequest", "ExceptionResponse", "400 BadRequest", false},
+	}
+
+	for _, tt := range tests {
+		res := Response{CommuniqueType: tt.response, Header: ResponseHeader{StatusCode: tt.status}}
+		err := checkResponse(tt.request, res)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkResponse(%s, %s %s) = %v, want ok %v", tt.request, tt.response, tt.status, err, tt.ok)
+		}
+	}
+}
+
+func TestZoneColorNotColorZone(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	err := c.ZoneColor("1", ColorOptions{Kelvin: 2700})
+	if err == nil || err.Error() != "zone 1 does not support color (control type Dimmed)" {
+		t.Errorf("ZoneColor(1) error = %v", err)
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("sent %d requests, want only the zone lookup", n)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// lutronService is the DNS-SD service type Lutron controllers advertise.
+const lutronService = "_lutron._tcp.local."
+
+// DefaultDiscoveryTimeout is how long multicast DNS queries wait for answers.
+const DefaultDiscoveryTimeout = 3 * time.Second
+
+// mdnsAddr is where multicast DNS queries are sent.
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Controller is a Lutron controller found on the local network.
+type Controller struct {
+	Instance string
+	Hostname string
+	Addrs    []string
+	Port     int
+	Serial   string
+	Model    string
+
+	TXT map[string]string `json:",omitempty"`
+}
+
+// Host returns the controller's hostname, or its first address if it didn't
+// advertise one.
+func (c Controller) Host() string {
+	if c.Hostname != "" {
+		return c.Hostname
+	}
+	if len(c.Addrs) > 0 {
+		return c.Addrs[0]
+	}
+	return ""
+}
+
+// Discover finds Lutron controllers on the local network by browsing for the
+// `_lutron._tcp` service with multicast DNS. It returns every controller that
+// answers within the timeout.
+func Discover(timeout time.Duration) ([]Controller, error) {
+	return DiscoverContext(context.Background(), timeout)
+}
+
+// DiscoverContext is like Discover but uses the provided context.
+func DiscoverContext(ctx context.Context, timeout time.Duration) ([]Controller, error) {
+	controllers := map[string]*Controller{}
+	order := []string{}
+	instance := func(name string) *Controller {
+		key := strings.ToLower(name)
+		c, ok := controllers[key]
+		if !ok {
+			c = &Controller{Instance: strings.TrimSuffix(strings.TrimSuffix(name, "."+lutronService), "."), TXT: map[string]string{}}
+			controllers[key] = c
+			order = append(order, key)
+		}
+		return c
+	}
+	isInstance := func(name string) bool {
+		return strings.HasSuffix(strings.ToLower(name), "."+lutronService)
+	}
+
+	hosts := map[string][]string{}
+	question := dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(lutronService),
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET,
+	}
+	err := mdnsQuery(ctx, []dnsmessage.Question{question}, timeout, func(rr dnsmessage.Resource) bool {
+		name := rr.Header.Name.String()
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if strings.EqualFold(name, lutronService) && isInstance(body.PTR.String()) {
+				instance(body.PTR.String())
+			}
+		case *dnsmessage.SRVResource:
+			if isInstance(name) {
+				c := instance(name)
+				c.Hostname = body.Target.String()
+				c.Port = int(body.Port)
+			}
+		case *dnsmessage.TXTResource:
+			if isInstance(name) {
+				c := instance(name)
+				for _, txt := range body.TXT {
+					key, value, _ := strings.Cut(txt, "=")
+					c.TXT[strings.ToUpper(key)] = value
+				}
+			}
+		case *dnsmessage.AResource:
+			hosts[strings.ToLower(name)] = appendAddr(hosts[strings.ToLower(name)], net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			hosts[strings.ToLower(name)] = appendAddr(hosts[strings.ToLower(name)], net.IP(body.AAAA[:]).String())
+		}
+		return false
+	})
+	if err != nil {
+		return []Controller{}, err
+	}
+
+	result := []Controller{}
+	for _, key := range order {
+		c := controllers[key]
+		c.Addrs = hosts[strings.ToLower(c.Hostname)]
+		c.Hostname = strings.TrimSuffix(c.Hostname, ".")
+		if len(c.Addrs) == 0 && c.Hostname != "" {
+			// Not every responder includes addresses with the service
+			// records, so ask for them.
+			addrs, err := LookupMDNSContext(ctx, c.Hostname, timeout)
+			if err == nil {
+				c.Addrs = addrs
+			}
+		}
+		c.Serial = controllerSerial(c)
+		c.Model = firstTXT(c.TXT, "SYSTYPE", "MODEL", "DEVCLASS")
+		result = append(result, *c)
+	}
+
+	return result, nil
+}
+
+// LookupMDNS resolves a `.local` hostname with multicast DNS, returning its
+// addresses with IPv4 addresses first.
+func LookupMDNS(host string, timeout time.Duration) ([]string, error) {
+	return LookupMDNSContext(context.Background(), host, timeout)
+}
+
+// LookupMDNSContext is like LookupMDNS but uses the provided context.
+func LookupMDNSContext(ctx context.Context, host string, timeout time.Duration) ([]string, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return []string{}, err
+	}
+
+	questions := []dnsmessage.Question{
+		{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		{Name: name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET},
+	}
+	v4, v6 := []string{}, []string{}
+	err = mdnsQuery(ctx, questions, timeout, func(rr dnsmessage.Resource) bool {
+		if !strings.EqualFold(rr.Header.Name.String(), name.String()) {
+			return false
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			v4 = appendAddr(v4, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			v6 = appendAddr(v6, net.IP(body.AAAA[:]).String())
+		}
+		return len(v4) > 0
+	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	addrs := append(v4, v6...)
+	if len(addrs) == 0 {
+		return []string{}, fmt.Errorf("mdns: no answer for %s", host)
+	}
+	return addrs, nil
+}
+
+// isLocalHost reports whether host is in the `.local` domain, which is
+// resolved with multicast DNS.
+func isLocalHost(host string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), ".local")
+}
+
+// mdnsQuery sends the questions and passes every record in the responses to
+// handle until it returns true or the timeout expires. If ctx is done first,
+// its error is returned. Queries are sent from
+// an ephemeral port, so responders answer with unicast (RFC 6762 §6.7) and
+// there's no need to join the multicast group.
+func mdnsQuery(ctx context.Context, questions []dnsmessage.Question, timeout time.Duration, handle func(dnsmessage.Resource) bool) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Cancelling ctx interrupts the wait for answers.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	msg := dnsmessage.Message{Questions: questions}
+	packed, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.WriteToUDP(packed, mdnsAddr)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	d, ctxDeadline := ctx.Deadline()
+	if ctxDeadline && d.Before(deadline) {
+		deadline = d
+	} else {
+		ctxDeadline = false
+	}
+	err = conn.SetReadDeadline(deadline)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// The read deadline can pass a moment before ctx notices its own.
+			if ctxDeadline {
+				<-ctx.Done()
+			}
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+
+		var res dnsmessage.Message
+		err = res.Unpack(buf[:n])
+		if err != nil || !res.Header.Response {
+			continue
+		}
+
+		records := append(append(res.Answers, res.Authorities...), res.Additionals...)
+		for _, rr := range records {
+			if handle(rr) {
+				return nil
+			}
+		}
+	}
+}
+
+// controllerSerial returns the controller's serial number from its TXT
+// records, or from its hostname (`Lutron-<serial in hex>.local`).
+func controllerSerial(c *Controller) string {
+	if serial := firstTXT(c.TXT, "SERNUM", "SERIAL"); serial != "" {
+		return serial
+	}
+
+	label, _, _ := strings.Cut(c.Hostname, ".")
+	if !strings.HasPrefix(label, "Lutron-") {
+		return ""
+	}
+	serial, err := strconv.ParseUint(strings.TrimPrefix(label, "Lutron-"), 16, 32)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(serial, 10)
+}
+
+func firstTXT(txt map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := txt[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func appendAddr(addrs []string, addr string) []string {
+	for _, a := range addrs {
+		if a == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
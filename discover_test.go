@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mdnsResponder answers multicast DNS queries sent to mdnsAddr with the
+// records its handler returns for each question. Questions with no records
+// go unanswered, like on a real network.
+func mdnsResponder(t *testing.T, handler func(dnsmessage.Question) []dnsmessage.Resource) {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := mdnsAddr
+	mdnsAddr = conn.LocalAddr().(*net.UDPAddr)
+	t.Cleanup(func() {
+		mdnsAddr = addr
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 9000)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if query.Unpack(buf[:n]) != nil {
+				continue
+			}
+
+			res := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+			for _, q := range query.Questions {
+				res.Answers = append(res.Answers, handler(q)...)
+			}
+			if len(res.Answers) == 0 {
+				continue
+			}
+
+			packed, err := res.Pack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.WriteToUDP(packed, from)
+		}
+	}()
+}
+
+func rrHeader(name string, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET, TTL: 120}
+}
+
+// bridges answers like two controllers: one that sends everything with its
+// service records, and one that only answers address queries separately.
+func bridges(q dnsmessage.Question) []dnsmessage.Resource {
+	name := strings.ToLower(q.Name.String())
+	switch {
+	case name == lutronService && q.Type == dnsmessage.TypePTR:
+		return []dnsmessage.Resource{
+			{Header: rrHeader(lutronService, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Lutron Status." + lutronService)}},
+			{Header: rrHeader("Lutron Status."+lutronService, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("Lutron-0123abcd.local."), Port: 22}},
+			{Header: rrHeader("Lutron Status."+lutronService, dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: []string{"systype=SmartBridge", "CODEVER=08.25.17f000"}}},
+			{Header: rrHeader("Lutron-0123abcd.local.", dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}}},
+			{Header: rrHeader(lutronService, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Upstairs." + lutronService)}},
+			{Header: rrHeader("Upstairs."+lutronService, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("upstairs.local."), Port: 22}},
+			{Header: rrHeader("Upstairs."+lutronService, dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: []string{"SERNUM=87654321", "MODEL=RA2 Select"}}},
+		}
+	case name == "upstairs.local." && q.Type == dnsmessage.TypeA:
+		// Both addresses, IPv6 first.
+		return []dnsmessage.Resource{
+			{Header: rrHeader("upstairs.local.", dnsmessage.TypeAAAA), Body: &dnsmessage.AAAAResource{AAAA: [16]byte{0xfe, 0x80, 15: 1}}},
+			{Header: rrHeader("upstairs.local.", dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte{192, 168, 1, 30}}},
+		}
+	}
+	return nil
+}
+
+func TestDiscover(t *testing.T) {
+	mdnsResponder(t, bridges)
+
+	controllers, err := Discover(200 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Controller{
+		{
+			Instance: "Lutron Status",
+			Hostname: "Lutron-0123abcd.local",
+			Addrs:    []string{"192.168.1.20"},
+			Port:     22,
+			Serial:   "19114957",
+			Model:    "SmartBridge",
+			TXT:      map[string]string{"SYSTYPE": "SmartBridge", "CODEVER": "08.25.17f000"},
+		},
+		{
+			Instance: "Upstairs",
+			Hostname: "upstairs.local",
+			Addrs:    []string{"192.168.1.30", "fe80::1"},
+			Port:     22,
+			Serial:   "87654321",
+			Model:    "RA2 Select",
+			TXT:      map[string]string{"SERNUM": "87654321", "MODEL": "RA2 Select"},
+		},
+	}
+	if !reflect.DeepEqual(controllers, want) {
+		t.Errorf("Discover() =\n%+v\nwant\n%+v", controllers, want)
+	}
+}
+
+func TestDiscoverNoAnswers(t *testing.T) {
+	mdnsResponder(t, func(dnsmessage.Question) []dnsmessage.Resource { return nil })
+
+	start := time.Now()
+	controllers, err := Discover(100 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 0 {
+		t.Errorf("Discover() = %+v, want no controllers", controllers)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Discover() took %v, want about the timeout", elapsed)
+	}
+}
+
+func TestLookupMDNS(t *testing.T) {
+	mdnsResponder(t, bridges)
+
+	addrs, err := LookupMDNS("upstairs.local", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.168.1.30", "fe80::1"}
+	if !reflect.DeepEqual(addrs, want) {
+		t.Errorf("LookupMDNS() = %v, want %v", addrs, want)
+	}
+
+	start := time.Now()
+	_, err = LookupMDNS("missing.local", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no answer") {
+		t.Errorf("LookupMDNS(missing.local) error = %v, want no answer", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("LookupMDNS(missing.local) took %v, want about the timeout", elapsed)
+	}
+}
+
+func TestDiscoverContext(t *testing.T) {
+	mdnsResponder(t, func(dnsmessage.Question) []dnsmessage.Resource { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := DiscoverContext(ctx, 10*time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DiscoverContext() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("DiscoverContext() took %v, want it to stop with the context", elapsed)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LEAPError is returned when the controller rejects a request, either with an
+// `ExceptionResponse` or with a response carrying a non-success status.
+type LEAPError struct {
+	StatusCode int    // e.g. 404
+	Status     string // e.g. "NotFound"
+	URL        string
+	ClientTag  string
+	Message    string
+}
+
+func (e *LEAPError) Error() string {
+	status := fmt.Sprintf("%d %s", e.StatusCode, e.Status)
+	if e.StatusCode == 0 {
+		status = e.Status
+	}
+
+	if e.Message != "" {
+		return fmt.Sprintf("received %s: %s", status, e.Message)
+	}
+	return fmt.Sprintf("received %s status", status)
+}
+
+// Is reports whether target is a LEAPError with the same status code, so
+// that `errors.Is(err, ErrNotFound)` matches any 404 from the controller.
+func (e *LEAPError) Is(target error) bool {
+	t, ok := target.(*LEAPError)
+	return ok && t.StatusCode != 0 && t.StatusCode == e.StatusCode
+}
+
+// Sentinel errors for the statuses LEAP controllers commonly return. Compare
+// against them with errors.Is; the returned errors carry the request details.
+var (
+	ErrBadRequest          = &LEAPError{StatusCode: 400, Status: "BadRequest"}
+	ErrUnauthorized        = &LEAPError{StatusCode: 401, Status: "Unauthorized"}
+	ErrForbidden           = &LEAPError{StatusCode: 403, Status: "Forbidden"}
+	ErrNotFound            = &LEAPError{StatusCode: 404, Status: "NotFound"}
+	ErrMethodNotAllowed    = &LEAPError{StatusCode: 405, Status: "MethodNotAllowed"}
+	ErrConflict            = &LEAPError{StatusCode: 409, Status: "Conflict"}
+	ErrInternalServerError = &LEAPError{StatusCode: 500, Status: "InternalServerError"}
+	ErrNotImplemented      = &LEAPError{StatusCode: 501, Status: "NotImplemented"}
+	ErrServiceUnavailable  = &LEAPError{StatusCode: 503, Status: "ServiceUnavailable"}
+)
+
+// newLEAPError builds a LEAPError from a failed response.
+func newLEAPError(res Response) *LEAPError {
+	code, text := parseStatus(res.Header.StatusCode)
+
+	msg, _ := res.Body["Message"].(string)
+
+	return &LEAPError{
+		StatusCode: code,
+		Status:     text,
+		URL:        res.Header.URL,
+		ClientTag:  res.Header.ClientTag,
+		Message:    msg,
+	}
+}
+
+// IsBadRequest reports whether err is a 400 response from the controller.
+func IsBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+// IsNotFound reports whether err is a 404 response from the controller.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsConflict reports whether err is a 409 response from the controller.
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+// IsUnavailable reports whether err is a 503 response, which the controller
+// sends when it is busy and the request may be retried.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrServiceUnavailable)
+}
+
+// CertificateChangedError is returned when the controller's certificate isn't
+// signed by the CA saved when tron was paired with it: the controller was
+// reset or replaced, or something else is answering at its address.
+type CertificateChangedError struct {
+	Host       string
+	CACertPath string
+	Err        error
+}
+
+func (e *CertificateChangedError) Error() string {
+	return fmt.Sprintf("certificate changed: the certificate presented by %s is not signed by the CA saved when pairing (%s): %s. "+
+		"If the controller was reset or replaced, pair again; otherwise another device may be impersonating it", e.Host, e.CACertPath, e.Err)
+}
+
+func (e *CertificateChangedError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FanSpeed is a speed setting for `FanSpeed` zones.
+type FanSpeed string
+
+const (
+	FanSpeedOff        FanSpeed = "Off"
+	FanSpeedLow        FanSpeed = "Low"
+	FanSpeedMedium     FanSpeed = "Medium"
+	FanSpeedMediumHigh FanSpeed = "MediumHigh"
+	FanSpeedHigh       FanSpeed = "High"
+)
+
+var fanSpeeds = []FanSpeed{
+	FanSpeedOff,
+	FanSpeedLow,
+	FanSpeedMedium,
+	FanSpeedMediumHigh,
+	FanSpeedHigh,
+}
+
+// ParseFanSpeed converts a case-insensitive speed name (e.g. "mediumhigh")
+// into a FanSpeed.
+func ParseFanSpeed(s string) (FanSpeed, error) {
+	for _, speed := range fanSpeeds {
+		if strings.EqualFold(s, string(speed)) {
+			return speed, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown fan speed %q", s)
+}
+
+type FanSpeedParameters struct {
+	FanSpeed FanSpeed
+}
+
+// ZoneFanSpeed sets the speed of a `FanSpeed` zone.
+func (c *Client) ZoneFanSpeed(id string, speed FanSpeed) error {
+	return c.ZoneFanSpeedContext(context.Background(), id, speed)
+}
+
+// ZoneFanSpeedContext is like ZoneFanSpeed but uses the provided context.
+func (c *Client) ZoneFanSpeedContext(ctx context.Context, id string, speed FanSpeed) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{
+		CommandType: "GoToFanSpeed",
+		FanSpeedParameters: &FanSpeedParameters{
+			FanSpeed: speed,
+		},
+	})
+}
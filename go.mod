@@ -3,9 +3,14 @@ module github.com/paulrosania/tron
 go 1.19
 
 require (
-	github.com/google/uuid v1.3.0
 	github.com/mitchellh/mapstructure v1.5.0
+	golang.org/x/net v0.17.0
 	gopkg.in/ini.v1 v1.67.0
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.4.0
 )
 
-require github.com/stretchr/testify v1.8.1 // indirect
+require (
+	github.com/stretchr/testify v1.8.1 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+)
@@ -0,0 +1,137 @@
+package leaptest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// authority is the fake controller's CA, which signs its own certificate and
+// the client certificates it hands out when pairing.
+type authority struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	pem  []byte
+}
+
+func newAuthority() (*authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "leaptest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authority{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
+
+// sign issues a certificate for the public key.
+func (a *authority) sign(name string, pub crypto.PublicKey, usage x509.ExtKeyUsage) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, pub, a.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// serverCertificate issues the certificate the fake controller serves.
+func (a *authority) serverCertificate() (tls.Certificate, error) {
+	certPEM, keyPEM, err := a.issue("leaptest", x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// issue generates a key and a certificate for it.
+func (a *authority) issue(name string, usage x509.ExtKeyUsage) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM, err := a.sign(name, key.Public(), usage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// ClientIdentity writes a client certificate the server accepts, its key and
+// the server's CA certificate to dir, as if the client had already paired.
+func (s *Server) ClientIdentity(dir string) (caPath string, certPath string, keyPath string, err error) {
+	certPEM, keyPEM, err := s.ca.issue("leaptest client", x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	caPath = filepath.Join(dir, "ca.crt")
+	certPath = filepath.Join(dir, "client.crt")
+	keyPath = filepath.Join(dir, "client.key")
+	for path, data := range map[string][]byte{caPath: s.ca.pem, certPath: certPEM, keyPath: keyPEM} {
+		err = os.WriteFile(path, data, 0600)
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+
+	return caPath, certPath, keyPath, nil
+}
+
+// CACertificate returns the server's CA certificate as PEM.
+func (s *Server) CACertificate() []byte {
+	return s.ca.pem
+}
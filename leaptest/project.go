@@ -0,0 +1,70 @@
+package leaptest
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Project is the fixture a Server answers from. Each list holds definitions
+// exactly as the controller returns them from the matching endpoint (e.g. the
+// `Zones` from `tron get /zone`), so fixtures can be captured from a real
+// controller.
+type Project struct {
+	Project map[string]any `json:",omitempty"`
+
+	Areas          []map[string]any `json:",omitempty"`
+	Zones          []map[string]any `json:",omitempty"`
+	Devices        []map[string]any `json:",omitempty"`
+	ButtonGroups   []map[string]any `json:",omitempty"`
+	Buttons        []map[string]any `json:",omitempty"`
+	VirtualButtons []map[string]any `json:",omitempty"`
+
+	// ZoneStatuses sets the zones' initial status. Zones without one start
+	// off.
+	ZoneStatuses []map[string]any `json:",omitempty"`
+}
+
+// LoadProject reads a fixture project from a JSON file.
+func LoadProject(path string) (*Project, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var project Project
+	err = json.Unmarshal(raw, &project)
+	if err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
+// collection describes a list endpoint, e.g. `/zone`, and the keys its
+// definitions are returned under.
+type collection struct {
+	list   string // e.g. "Zones"
+	single string // e.g. "Zone"
+	items  func(p *Project) []map[string]any
+}
+
+var collections = map[string]collection{
+	"area":          {"Areas", "Area", func(p *Project) []map[string]any { return p.Areas }},
+	"zone":          {"Zones", "Zone", func(p *Project) []map[string]any { return p.Zones }},
+	"device":        {"Devices", "Device", func(p *Project) []map[string]any { return p.Devices }},
+	"buttongroup":   {"ButtonGroups", "ButtonGroup", func(p *Project) []map[string]any { return p.ButtonGroups }},
+	"button":        {"Buttons", "Button", func(p *Project) []map[string]any { return p.Buttons }},
+	"virtualbutton": {"VirtualButtons", "VirtualButton", func(p *Project) []map[string]any { return p.VirtualButtons }},
+}
+
+// find returns the definition with the given href.
+func (p *Project) find(href string) (map[string]any, bool) {
+	for _, c := range collections {
+		for _, item := range c.items(p) {
+			if item["href"] == href {
+				return item, true
+			}
+		}
+	}
+	return nil, false
+}
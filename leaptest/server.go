@@ -0,0 +1,755 @@
+// Package leaptest provides a fake Lutron LEAP controller for testing LEAP
+// clients.
+//
+// A Server answers requests from a fixture Project over TLS, the way a
+// Caséta Smart Bridge would: definitions are read back as loaded, zone
+// levels follow the commands sent to them, and the pairing port signs client
+// certificates once the (simulated) button is pressed.
+package leaptest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LEAPVersion is the protocol version the server reports to pings.
+const LEAPVersion = 1.115
+
+// PairingListHref is the path of the server's pairing list.
+const PairingListHref = "/server/leap/pairinglist"
+
+// Communique is a LEAP message, as sent by either side.
+type Communique struct {
+	CommuniqueType string `json:",omitempty"`
+	Header         Header
+	Body           map[string]any `json:",omitempty"`
+}
+
+type Header struct {
+	ClientTag       string `json:",omitempty"`
+	RequestType     string `json:",omitempty"`
+	MessageBodyType string `json:",omitempty"`
+	StatusCode      string `json:",omitempty"`
+	URL             string `json:"Url,omitempty"`
+}
+
+// Server is a fake LEAP controller listening on the loopback interface.
+type Server struct {
+	Host        string
+	ControlPort int
+	PairingPort int
+
+	ca      *authority
+	control net.Listener
+	pairing net.Listener
+
+	mu       sync.Mutex
+	project  *Project
+	statuses map[string]map[string]any // by zone href
+	pairings []map[string]any
+	nextID   int
+	requests []Communique
+	conns    map[*conn]bool
+	pushes   []push
+	closed   bool
+
+	unresponsive bool
+
+	pressed   chan struct{}
+	pressOnce sync.Once
+
+	wg sync.WaitGroup
+}
+
+// conn is a connection to the control port.
+type conn struct {
+	net.Conn
+
+	wmu  sync.Mutex
+	subs map[string]string // by tag, the subscribed path; guarded by Server.mu
+}
+
+// push is a subscription update waiting to be sent.
+type push struct {
+	conn *conn
+	msg  Communique
+}
+
+func (c *conn) send(msg Communique) error {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	_, err = c.Write(append(raw, '\n'))
+	return err
+}
+
+// NewServer starts a server for the project. Like httptest.NewServer, it
+// panics if the server can't be started. Callers should Close it when done.
+func NewServer(project *Project) *Server {
+	if project == nil {
+		project = &Project{}
+	}
+
+	s, err := newServer(project)
+	if err != nil {
+		panic(fmt.Sprintf("leaptest: failed to start server: %v", err))
+	}
+	return s
+}
+
+func newServer(project *Project) (*Server, error) {
+	ca, err := newAuthority()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := ca.serverCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	control, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Clients pair with a well-known certificate that isn't signed by our
+	// CA, so the pairing port takes any certificate.
+	pairing, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+
+	s := &Server{
+		Host:        "127.0.0.1",
+		ControlPort: control.Addr().(*net.TCPAddr).Port,
+		PairingPort: pairing.Addr().(*net.TCPAddr).Port,
+		ca:          ca,
+		control:     control,
+		pairing:     pairing,
+		project:     project,
+		statuses:    map[string]map[string]any{},
+		pairings:    []map[string]any{},
+		nextID:      1,
+		conns:       map[*conn]bool{},
+		pressed:     make(chan struct{}),
+	}
+
+	for _, zone := range project.Zones {
+		href, _ := zone["href"].(string)
+		s.statuses[href] = map[string]any{
+			"href":           href + "/status",
+			"Zone":           map[string]any{"href": href},
+			"Level":          0,
+			"StatusAccuracy": "Good",
+		}
+	}
+	for _, status := range project.ZoneStatuses {
+		zone, _ := status["Zone"].(map[string]any)
+		href, _ := zone["href"].(string)
+		if current, ok := s.statuses[href]; ok {
+			for k, v := range status {
+				current[k] = v
+			}
+		}
+	}
+
+	s.wg.Add(2)
+	go s.serve(control, s.serveControl)
+	go s.serve(pairing, s.servePairing)
+
+	return s, nil
+}
+
+// Close stops the server and closes every open connection.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.control.Close()
+	s.pairing.Close()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// PressButton simulates pressing the pairing button on the back of the
+// controller, letting clients waiting on the pairing port pair.
+func (s *Server) PressButton() {
+	s.pressOnce.Do(func() { close(s.pressed) })
+}
+
+// ZoneLevel returns the current level of the zone.
+func (s *Server) ZoneLevel(href string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[href]
+	if !ok {
+		return 0, false
+	}
+	level, _ := number(status["Level"])
+	return level, true
+}
+
+// SetZoneLevel changes the level of the zone, as if it had been dimmed
+// locally, and notifies subscribers.
+func (s *Server) SetZoneLevel(href string, level int) bool {
+	s.mu.Lock()
+	status, ok := s.statuses[href]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	status["Level"] = level
+	s.notify(href)
+	s.mu.Unlock()
+
+	s.flush()
+	return true
+}
+
+// DropConnections closes every open connection, like a controller rebooting
+// or a network blip. The server keeps accepting new connections.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Connections returns the number of open connections to either port.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// SetUnresponsive makes the server stop answering requests on the control
+// port, like a controller that hangs or reboots without closing connections.
+// Requests received while unresponsive are never answered.
+func (s *Server) SetUnresponsive(unresponsive bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unresponsive = unresponsive
+}
+
+// Pairings returns the clients paired with the server, in the order they
+// paired.
+func (s *Server) Pairings() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]map[string]any{}, s.pairings...)
+}
+
+// Requests returns every communique received on the control port so far.
+func (s *Server) Requests() []Communique {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Communique{}, s.requests...)
+}
+
+func (s *Server) serve(l net.Listener, handle func(*conn)) {
+	defer s.wg.Done()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &conn{Conn: nc, subs: map[string]string{}}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[c] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+				c.Close()
+			}()
+
+			handle(c)
+		}()
+	}
+}
+
+func (s *Server) serveControl(c *conn) {
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var req Communique
+		err = json.Unmarshal(line, &req)
+		if err != nil {
+			c.send(exception(req, "400 BadRequest", "invalid communique"))
+			continue
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		if s.unresponsive {
+			s.mu.Unlock()
+			continue
+		}
+		res := s.handle(c, req)
+		s.mu.Unlock()
+
+		s.flush()
+
+		res.Header.ClientTag = req.Header.ClientTag
+		if res.Header.URL == "" {
+			res.Header.URL = req.Header.URL
+		}
+
+		err = c.send(res)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a request. It is called with s.mu held.
+func (s *Server) handle(c *conn, req Communique) Communique {
+	path := req.Header.URL
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	switch req.CommuniqueType {
+	case "ReadRequest":
+		body, ok := s.read(path)
+		if !ok {
+			return notFound(req)
+		}
+		return response("ReadResponse", "200 OK", body)
+	case "CreateRequest":
+		return s.create(req, path)
+	case "DeleteRequest":
+		return s.delete(req, path)
+	case "SubscribeRequest":
+		body, ok := s.read(path)
+		if !ok || !strings.HasSuffix(path, "/status") {
+			return notFound(req)
+		}
+		c.subs[req.Header.ClientTag] = path
+		return response("SubscribeResponse", "200 OK", body)
+	case "UpdateRequest":
+		return exception(req, "405 MethodNotAllowed", "updates are not supported")
+	default:
+		return exception(req, "400 BadRequest", fmt.Sprintf("unsupported communique type %q", req.CommuniqueType))
+	}
+}
+
+var (
+	itemPath   = regexp.MustCompile(`^/([a-z]+)/(\d+)$`)
+	statusPath = regexp.MustCompile(`^/zone/(\d+)/status$`)
+)
+
+// read returns the body of a `ReadResponse` for the path.
+func (s *Server) read(path string) (map[string]any, bool) {
+	switch path {
+	case "/server/1/status/ping":
+		return map[string]any{"PingResponse": map[string]any{"LEAPVersion": LEAPVersion}}, true
+	case "/server":
+		return map[string]any{"Servers": []any{s.server()}}, true
+	case "/server/1":
+		return map[string]any{"Server": s.server()}, true
+	case "/project":
+		if s.project.Project == nil {
+			return nil, false
+		}
+		return map[string]any{"Project": s.project.Project}, true
+	case "/zone/status":
+		statuses := []any{}
+		for _, href := range s.zoneHrefs() {
+			statuses = append(statuses, clone(s.statuses[href]))
+		}
+		return map[string]any{"ZoneStatuses": statuses}, true
+	case PairingListHref:
+		pairings := []any{}
+		for _, p := range s.pairings {
+			pairings = append(pairings, p)
+		}
+		return map[string]any{"PairingList": map[string]any{"href": PairingListHref, "Pairings": pairings}}, true
+	}
+
+	if m := statusPath.FindStringSubmatch(path); m != nil {
+		status, ok := s.statuses["/zone/"+m[1]]
+		if !ok {
+			return nil, false
+		}
+		return map[string]any{"ZoneStatus": clone(status)}, true
+	}
+
+	if c, ok := collections[strings.TrimPrefix(path, "/")]; ok {
+		items := []any{}
+		for _, item := range c.items(s.project) {
+			items = append(items, item)
+		}
+		return map[string]any{c.list: items}, true
+	}
+
+	if m := itemPath.FindStringSubmatch(path); m != nil {
+		if c, ok := collections[m[1]]; ok {
+			for _, item := range c.items(s.project) {
+				if item["href"] == path {
+					return map[string]any{c.single: item}, true
+				}
+			}
+		}
+	}
+
+	if strings.HasPrefix(path, PairingListHref+"/") {
+		for _, p := range s.pairings {
+			if p["href"] == path {
+				return map[string]any{"Pairing": p}, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func (s *Server) server() map[string]any {
+	return map[string]any{
+		"href":            "/server/1",
+		"Type":            "LEAP",
+		"ProtocolVersion": fmt.Sprint(LEAPVersion),
+		"EnableState":     "Enabled",
+		"Endpoints": []any{
+			map[string]any{"Protocol": "TCP", "Port": s.ControlPort},
+		},
+		"LEAPProperties": map[string]any{
+			"PairingList": map[string]any{"href": PairingListHref},
+		},
+	}
+}
+
+func (s *Server) zoneHrefs() []string {
+	hrefs := []string{}
+	for href := range s.statuses {
+		hrefs = append(hrefs, href)
+	}
+	sort.Slice(hrefs, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(hrefs[i], "/zone/"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(hrefs[j], "/zone/"))
+		return a < b
+	})
+	return hrefs
+}
+
+// create executes a command sent to a command processor.
+func (s *Server) create(req Communique, path string) Communique {
+	target := strings.TrimSuffix(path, "/commandprocessor")
+	if target == path {
+		return exception(req, "405 MethodNotAllowed", "only command processors accept commands")
+	}
+
+	if _, ok := s.project.find(target); !ok {
+		return notFound(req)
+	}
+
+	command, _ := req.Body["Command"].(map[string]any)
+	commandType, _ := command["CommandType"].(string)
+
+	status, isZone := s.statuses[target]
+	if !isZone {
+		// Buttons and virtual buttons accept their commands without any
+		// visible effect.
+		return response("CreateResponse", "201 Created", nil)
+	}
+
+	switch commandType {
+	case "GoToLevel":
+		params, _ := command["Parameter"].([]any)
+		level, ok := 0, false
+		for _, p := range params {
+			p, _ := p.(map[string]any)
+			if p["Type"] == "Level" {
+				level, ok = number(p["Value"])
+			}
+		}
+		if !ok {
+			return exception(req, "400 BadRequest", "missing Level parameter")
+		}
+		status["Level"] = level
+	case "GoToDimmedLevel":
+		params, _ := command["DimmedLevelParameters"].(map[string]any)
+		level, ok := number(params["Level"])
+		if !ok {
+			return exception(req, "400 BadRequest", "missing DimmedLevelParameters.Level")
+		}
+		status["Level"] = level
+	case "GoToSwitchedLevel":
+		params, _ := command["SwitchedLevelParameters"].(map[string]any)
+		switched, _ := params["SwitchedLevel"].(string)
+		switch switched {
+		case "On":
+			status["Level"] = 100
+		case "Off":
+			status["Level"] = 0
+		default:
+			return exception(req, "400 BadRequest", "invalid SwitchedLevel")
+		}
+		status["SwitchedLevel"] = switched
+	default:
+		return exception(req, "400 BadRequest", fmt.Sprintf("unsupported command %q", commandType))
+	}
+
+	s.notify(target)
+
+	return response("CreateResponse", "201 Created", map[string]any{"ZoneStatus": clone(status)})
+}
+
+// delete removes an entry from the pairing list.
+func (s *Server) delete(req Communique, path string) Communique {
+	for i, p := range s.pairings {
+		if p["href"] == path {
+			s.pairings = append(s.pairings[:i], s.pairings[i+1:]...)
+			return response("DeleteResponse", "204 NoContent", nil)
+		}
+	}
+
+	if _, ok := s.read(path); ok {
+		return exception(req, "405 MethodNotAllowed", "resource can't be deleted")
+	}
+	return notFound(req)
+}
+
+// notify queues the zone's status for every connection subscribed to it. It
+// is called with s.mu held; the updates are sent by flush once it is released.
+func (s *Server) notify(zone string) {
+	status := clone(s.statuses[zone])
+	for c := range s.conns {
+		for tag, path := range c.subs {
+			if path != "/zone/status" && path != zone+"/status" {
+				continue
+			}
+
+			msg := response("ReadResponse", "200 OK", map[string]any{"ZoneStatus": status})
+			msg.Header.ClientTag = tag
+			msg.Header.URL = zone + "/status"
+			s.pushes = append(s.pushes, push{conn: c, msg: msg})
+		}
+	}
+}
+
+// flush sends the queued subscription updates.
+func (s *Server) flush() {
+	s.mu.Lock()
+	pushes := s.pushes
+	s.pushes = nil
+	s.mu.Unlock()
+
+	for _, p := range pushes {
+		p.conn.send(p.msg)
+	}
+}
+
+// servePairing runs the pairing handshake: the client is told its
+// permissions, and again once the button is pressed, after which it can
+// send a certificate signing request.
+func (s *Server) servePairing(c *conn) {
+	status := func(permissions ...string) Communique {
+		return Communique{
+			Header: Header{StatusCode: "200 OK", MessageBodyType: "OneStatusDefinition"},
+			Body:   map[string]any{"Status": map[string]any{"Permissions": permissions}},
+		}
+	}
+
+	err := c.send(status("Public"))
+	if err != nil {
+		return
+	}
+
+	// The client sends nothing until it has access, so a read only returns
+	// when it hangs up.
+	gone := make(chan struct{})
+	r := bufio.NewReader(c)
+	go func() {
+		r.Peek(1)
+		close(gone)
+	}()
+
+	select {
+	case <-s.pressed:
+	case <-gone:
+		return
+	}
+
+	err = c.send(status("Public", "PhysicalAccess"))
+	if err != nil {
+		return
+	}
+
+	<-gone
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Header Header
+		Body   struct {
+			CommandType string
+			Parameters  struct {
+				CSR         string
+				DisplayName string
+				DeviceUID   string
+				Role        string
+			}
+		}
+	}
+	err = json.Unmarshal(line, &req)
+	if err != nil || req.Body.CommandType != "CSR" {
+		c.send(exception(Communique{Header: req.Header}, "400 BadRequest", "expected a CSR"))
+		return
+	}
+
+	certPEM, err := s.signCSR(req.Body.Parameters.CSR)
+	if err != nil {
+		c.send(exception(Communique{Header: req.Header}, "400 BadRequest", err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	href := fmt.Sprintf("%s/%d", PairingListHref, s.nextID)
+	s.nextID++
+	s.pairings = append(s.pairings, map[string]any{
+		"href":        href,
+		"DisplayName": req.Body.Parameters.DisplayName,
+		"DeviceUID":   req.Body.Parameters.DeviceUID,
+		"Role":        req.Body.Parameters.Role,
+		"Certificate": string(certPEM),
+	})
+	s.mu.Unlock()
+
+	c.send(Communique{
+		Header: Header{StatusCode: "200 OK", ClientTag: req.Header.ClientTag, MessageBodyType: "OneSigningResultDefinition"},
+		Body: map[string]any{
+			"SigningResult": map[string]any{
+				"Certificate":     string(certPEM),
+				"RootCertificate": string(s.ca.pem),
+			},
+		},
+	})
+
+	// Like a real controller, leave hanging up to the client.
+	io.Copy(io.Discard, r)
+}
+
+func (s *Server) signCSR(csrPEM string) ([]byte, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("invalid CSR")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ca.sign(csr.Subject.CommonName, csr.PublicKey, x509.ExtKeyUsageClientAuth)
+}
+
+func response(communiqueType string, status string, body map[string]any) Communique {
+	return Communique{
+		CommuniqueType: communiqueType,
+		Header:         Header{StatusCode: status},
+		Body:           body,
+	}
+}
+
+func exception(req Communique, status string, message string) Communique {
+	return Communique{
+		CommuniqueType: "ExceptionResponse",
+		Header: Header{
+			MessageBodyType: "ExceptionDetail",
+			StatusCode:      status,
+			URL:             req.Header.URL,
+			ClientTag:       req.Header.ClientTag,
+		},
+		Body: map[string]any{"Message": message},
+	}
+}
+
+func notFound(req Communique) Communique {
+	return exception(req, "404 NotFound", fmt.Sprintf("%s not found", req.Header.URL))
+}
+
+// clone makes a shallow copy of m, so it can be sent after s.mu is released.
+func clone(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// number reads a JSON number, which may have been decoded as a float.
+func number(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	default:
+		return 0, false
+	}
+}
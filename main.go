@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -10,12 +12,14 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"gopkg.in/ini.v1"
+	"sync/atomic"
+	"time"
 )
 
 const defaultConfigFile = ".tronrc"
 const defaultCertDir = ".config/tron/certs"
+const defaultCacheFile = ".config/tron/cache.json"
+const defaultProfileDir = ".config/tron/profiles"
 
 //go:generate bash get_versions.sh
 
@@ -29,24 +33,52 @@ var GoVersion string
 var CommitHash string
 
 var verbose = flag.Bool("v", false, "Verbose")
+var insecure = flag.Bool("insecure", false, "Don't verify the controller's certificate")
+var profileName = flag.String("p", "", "Profile to use (default $TRON_PROFILE, or the one set with `tron profile use`)")
+var outputFormat = flag.String("o", "", "Output format (json, yaml, table or tsv)")
+var outputColumns = flag.String("columns", "", "Comma-separated columns for table and tsv output")
+var timeout = flag.Duration("timeout", 0, "Give up on the controller after this long (e.g. 30s)")
+var recordPath = flag.String("record", "", "Record communiques with the controller to a JSON lines `file`")
+var replayPath = flag.String("replay", "", "Answer requests from a recording `file` instead of the controller")
+
+var output Output
+
+// ctx bounds every request made by the command, and is done once -timeout
+// has passed.
+var ctx = context.Background()
+
+func init() {
+	flag.StringVar(profileName, "profile", "", "Same as -p")
+}
 
 func usage() {
-	fmt.Println("usage: tron [-v] <command>")
+	fmt.Println("usage: tron [-v] [-insecure] [-p profile] [-o format] [-columns cols] [-timeout duration] [-record file] [-replay file] <command>")
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println()
 	fmt.Println("   version      Print tron version")
 	fmt.Println()
+	fmt.Println("   discover     Find Lutron controllers on the local network")
 	fmt.Println("   pair         Pair with a Lutron Caséta controller")
+	fmt.Println("   profile      Manage controller profiles")
 	fmt.Println("   ping         Ping paired controller")
 	fmt.Println()
 	fmt.Println("   get          Query controller endpoints")
 	fmt.Println("   post         Send data to controller endpoints")
+	fmt.Println("   put          Update controller endpoints")
+	fmt.Println("   delete       Delete controller endpoints")
+	fmt.Println("   watch        Stream updates from controller endpoints")
+	fmt.Println()
+	fmt.Println("   cache        Manage the local project cache")
+	fmt.Println("   cert         Inspect, export and import the client certificate")
 	fmt.Println()
 	fmt.Println("   area         Control areas")
+	fmt.Println("   button       Control keypad and remote buttons")
 	fmt.Println("   device       Control Lutron devices")
+	fmt.Println("   scene        Activate scenes")
 	fmt.Println("   server       Control Lutron controllers")
 	fmt.Println("   service      Control 3rd-party services")
+	fmt.Println("   tree         Print the project hierarchy")
 	fmt.Println("   zone         Control zones")
 	fmt.Println()
 	os.Exit(1)
@@ -55,64 +87,140 @@ func usage() {
 func main() {
 	flag.Parse()
 
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	output.Format = *outputFormat
+	if *outputColumns != "" {
+		output.Columns = strings.Split(*outputColumns, ",")
+	}
+	if output.Format != "" && !contains(outputFormats, output.Format) {
+		fmt.Printf("error: unknown output format %q (expected one of %s)\n", output.Format, strings.Join(outputFormats, ", "))
+		os.Exit(1)
+	}
+
 	usr, err := user.Current()
 	if err != nil {
 		fmt.Println("error: failed to fetch current user:", err)
 		os.Exit(1)
 	}
-	dir := usr.HomeDir
-	configFilePath := filepath.Join(dir, defaultConfigFile)
 
-	cfg, err := ini.Load(configFilePath)
+	config, err := LoadConfig(usr.HomeDir)
 	if err != nil {
 		fmt.Println("error: failed to read file:", err)
 		os.Exit(1)
 	}
 
-	client := Client{
-		Host: cfg.Section("").Key("host").String(),
+	name := *profileName
+	if name == "" {
+		name = os.Getenv("TRON_PROFILE")
+	}
+	if name == "" {
+		name = config.Current()
+	}
+
+	if flag.Arg(0) == "profile" {
+		doProfileCommand(config, name, flag.Args()[1:])
+		return
+	}
+
+	profile, err := config.Profile(name)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	client := &Client{
+		Host: profile.Host,
 
-		CACertPath:     filepath.Join(dir, defaultCertDir, "ca.crt"),
-		ClientCertPath: filepath.Join(dir, defaultCertDir, "client.crt"),
-		ClientKeyPath:  filepath.Join(dir, defaultCertDir, "client.key"),
+		CACertPath:     profile.CACertPath,
+		ClientCertPath: profile.ClientCertPath,
+		ClientKeyPath:  profile.ClientKeyPath,
+
+		Insecure: *insecure,
+
+		CachePath: profile.CachePath,
 
 		Verbose: *verbose,
 	}
 
+	defer client.Close()
+
+	// Recordings should capture every lookup, and replays shouldn't mix
+	// with the real controller's cache, so both bypass it.
+	if *replayPath != "" {
+		client.Replay, err = LoadReplay(*replayPath)
+		if err != nil {
+			fmt.Println("error: failed to read recording:", err)
+			os.Exit(1)
+		}
+		client.CachePath = ""
+	}
+	if *recordPath != "" {
+		f, err := os.Create(*recordPath)
+		if err != nil {
+			fmt.Println("error: failed to create recording:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		client.Recorder = NewRecorder(f)
+		client.CachePath = ""
+	}
+
 	if *verbose {
-		os.Stderr.WriteString(fmt.Sprintf("Host: %s\n\n", client.Host))
+		os.Stderr.WriteString(fmt.Sprintf("Profile: %s\nHost: %s\n\n", profile.Name, client.Host))
 	}
 
 	if flag.NArg() > 0 {
 		cmd := flag.Arg(0)
 		switch cmd {
+		case "discover":
+			doDiscoverCommand(config, profile.Name, flag.Args()[1:])
 		case "pair":
-			err := client.Pair()
-			if err != nil {
-				fmt.Println("error: failed to pair controller:", err)
-				os.Exit(1)
-			}
+			doPairCommand(client, flag.Args()[1:])
+		case "cache":
+			doCacheCommand(client, flag.Args()[1:])
+		case "cert":
+			doCertCommand(client, flag.Args()[1:])
 		case "area":
 			doAreaCommand(client, flag.Args()[1:])
+		case "button":
+			doButtonCommand(client, flag.Args()[1:])
 		case "device":
 			doDeviceCommand(client, flag.Args()[1:])
+		case "scene":
+			doSceneCommand(client, flag.Args()[1:])
 		case "server":
 			doServerCommand(client, flag.Args()[1:])
 		case "service":
 			doServiceCommand(client, flag.Args()[1:])
+		case "tree":
+			doTreeCommand(client, flag.Args()[1:])
 		case "zone":
 			doZoneCommand(client, flag.Args()[1:])
 		case "get":
 			doGetCommand(client, flag.Args()[1:])
 		case "post":
 			doPostCommand(client, flag.Args()[1:])
+		case "put":
+			doPutCommand(client, flag.Args()[1:])
+		case "delete":
+			doDeleteCommand(client, flag.Args()[1:])
+		case "watch":
+			doWatchCommand(client, flag.Args()[1:])
 		case "ping":
-			res, err := client.Ping()
+			res, err := client.PingContext(ctx)
 			if err != nil {
 				fmt.Println("error: failed to ping controller:", err)
 				os.Exit(1)
 			}
-			fmt.Printf("OK (LEAP version %0.3f)\n", res.LEAPVersion)
+			render(res, func() {
+				fmt.Printf("OK (LEAP version %0.3f)\n", res.LEAPVersion)
+			})
 		case "version":
 			fmt.Printf("tron %s (%s) go/%s\n", Version, CommitHash, GoVersion)
 		default:
@@ -123,7 +231,50 @@ func main() {
 	}
 }
 
-func doAreaCommand(client Client, args []string) {
+// render prints v in the format selected with -o, or calls text to print the
+// default output if none was selected.
+func render(v any, text func()) {
+	err := output.Render(v, text)
+	if err != nil {
+		fmt.Println("error: failed to format output:", err)
+		os.Exit(1)
+	}
+}
+
+// renderResponse prints a raw response body, as indented JSON by default.
+func renderResponse(res map[string]any) {
+	render(res, func() {
+		out, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			fmt.Println("error: failed to format response as JSON:", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(out))
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveID resolves a user-supplied ID or name with the given resolver,
+// exiting if it doesn't refer to exactly one entity.
+func resolveID(kind string, resolve func(context.Context, string) (string, error), ref string) string {
+	id, err := resolve(ctx, ref)
+	if err != nil {
+		fmt.Printf("error: failed to resolve %s: %s\n", kind, err)
+		os.Exit(1)
+	}
+	return id
+}
+
+func doAreaCommand(client *Client, args []string) {
 	printArea := func(area AreaDefinition) {
 		fmt.Println("Name:    ", area.Name)
 		fmt.Println("Category:", area.Category.Type)
@@ -147,8 +298,675 @@ func doAreaCommand(client Client, args []string) {
 	}
 
 	usage := func() {
-		fmt.Println("usage: tron area list")
-		fmt.Println("       tron area info <id>")
+		fmt.Println("usage: tron area list")
+		fmt.Println("       tron area info <id|name>")
+		fmt.Println("       tron area on <id|name> [duration] [delay]")
+		fmt.Println("       tron area off <id|name> [duration] [delay]")
+		fmt.Println("       tron area dim <id|name> <level> [duration] [delay]")
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+
+	control := func(verb string, f func(context.Context, string, DimOptions) ([]AreaZoneResult, error), options DimOptions, rest []string) {
+		id := resolveID("area", client.ResolveAreaContext, args[1])
+		if len(rest) >= 1 {
+			options.Duration = rest[0]
+		}
+		if len(rest) >= 2 {
+			options.Delay = rest[1]
+		}
+		results, err := f(ctx, id, options)
+		if err != nil {
+			fmt.Printf("error: failed to %s area: %s\n", verb, err)
+			os.Exit(1)
+		}
+		type zoneResult struct {
+			Name  string
+			Href  string `json:"href"`
+			Error string `json:",omitempty"`
+		}
+		failed := false
+		rows := []zoneResult{}
+		for _, r := range results {
+			row := zoneResult{Name: r.Zone.Name, Href: r.Zone.Href}
+			if r.Err != nil {
+				failed = true
+				row.Error = r.Err.Error()
+			}
+			rows = append(rows, row)
+		}
+		render(rows, func() {
+			for _, r := range rows {
+				if r.Error != "" {
+					fmt.Printf("FAIL %s (%s): %s\n", r.Name, r.Href, r.Error)
+				} else {
+					fmt.Printf("OK   %s (%s)\n", r.Name, r.Href)
+				}
+			}
+		})
+		if failed {
+			os.Exit(1)
+		}
+	}
+
+	command := args[0]
+	switch command {
+	case "dim":
+		if len(args) < 3 {
+			usage()
+		}
+		level, err := strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Println("error: invalid level:", err)
+			os.Exit(1)
+		}
+		control("dim", client.AreaDimContext, DimOptions{Level: level}, args[3:])
+	case "off":
+		if len(args) < 2 {
+			usage()
+		}
+		control("turn off", client.AreaOffContext, DimOptions{}, args[2:])
+	case "on":
+		if len(args) < 2 {
+			usage()
+		}
+		control("turn on", client.AreaOnContext, DimOptions{}, args[2:])
+	case "info":
+		if len(args) < 2 {
+			usage()
+		}
+		id := resolveID("area", client.ResolveAreaContext, args[1])
+		area, err := client.AreaContext(ctx, id)
+		if err != nil {
+			fmt.Println("error: failed to retrieve area info:", err)
+			os.Exit(1)
+		}
+		render(area, func() { printArea(area) })
+	case "list":
+		list, err := client.AreasContext(ctx)
+		if err != nil {
+			fmt.Println("error: failed retrieve area list:", err)
+			os.Exit(1)
+		}
+		render(list, func() {
+			first := true
+			for _, area := range list {
+				if first {
+					first = false
+				} else {
+					fmt.Println("==========")
+					fmt.Println()
+				}
+				printArea(area)
+				fmt.Println()
+			}
+		})
+	default:
+		usage()
+	}
+}
+
+func doButtonCommand(client *Client, args []string) {
+	printButton := func(button ButtonDefinition) {
+		fmt.Println("Name:     ", button.Name)
+		fmt.Println("Path:     ", button.Href)
+		fmt.Println("Number:   ", button.ButtonNumber)
+		fmt.Println("Engraving:", button.Engraving.Text)
+		fmt.Println()
+		fmt.Println("Button Group:     ", button.Parent.Href)
+		fmt.Println("Programming Model:", button.ProgrammingModel.Href)
+		fmt.Println("LED:              ", button.AssociatedLED.Href)
+	}
+
+	printButtonGroup := func(group ButtonGroupDefinition, buttons map[string]ButtonDefinition) {
+		fmt.Println("Path:            ", group.Href)
+		fmt.Println("Device Path:     ", group.Parent.Href)
+		fmt.Println("Programming Type:", group.ProgrammingType)
+		fmt.Println()
+		fmt.Println("Buttons:")
+		for _, ref := range group.Buttons {
+			button, ok := buttons[ref.Href]
+			if !ok {
+				fmt.Println("-", ref.Href)
+				continue
+			}
+			label := button.Engraving.Text
+			if label == "" {
+				label = button.Name
+			}
+			fmt.Printf("- %s (%d: %s)\n", ref.Href, button.ButtonNumber, label)
+		}
+	}
+
+	usage := func() {
+		fmt.Println("usage: tron button list")
+		fmt.Println("       tron button info <id|name>")
+		fmt.Println("       tron button press <id|name>")
+		fmt.Println("       tron button hold <id|name>")
+		fmt.Println("       tron button release <id|name>")
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+
+	press := func(action ButtonAction) {
+		if len(args) < 2 {
+			usage()
+		}
+		id := resolveID("button", client.ResolveButtonContext, args[1])
+		err := client.ButtonPressContext(ctx, id, action)
+		if err != nil {
+			fmt.Println("error: failed to press button:", err)
+			os.Exit(1)
+		}
+	}
+
+	command := args[0]
+	switch command {
+	case "hold":
+		press(PressAndHold)
+	case "info":
+		if len(args) < 2 {
+			usage()
+		}
+		id := resolveID("button", client.ResolveButtonContext, args[1])
+		button, err := client.ButtonContext(ctx, id)
+		if err != nil {
+			fmt.Println("error: failed to retrieve button info:", err)
+			os.Exit(1)
+		}
+		render(button, func() { printButton(button) })
+	case "list":
+		groups, err := client.ButtonGroupsContext(ctx)
+		if err != nil {
+			fmt.Println("error: failed to retrieve button group list:", err)
+			os.Exit(1)
+		}
+		list, err := client.ButtonsContext(ctx)
+		if err != nil {
+			fmt.Println("error: failed to retrieve button list:", err)
+			os.Exit(1)
+		}
+		buttons := map[string]ButtonDefinition{}
+		for _, button := range list {
+			buttons[button.Href] = button
+		}
+		type buttonGroup struct {
+			ButtonGroupDefinition
+			Buttons []ButtonDefinition
+		}
+		rows := []buttonGroup{}
+		for _, group := range groups {
+			row := buttonGroup{ButtonGroupDefinition: group, Buttons: []ButtonDefinition{}}
+			for _, ref := range group.Buttons {
+				if button, ok := buttons[ref.Href]; ok {
+					row.Buttons = append(row.Buttons, button)
+				}
+			}
+			rows = append(rows, row)
+		}
+		render(rows, func() {
+			first := true
+			for _, group := range groups {
+				if first {
+					first = false
+				} else {
+					fmt.Println("==========")
+					fmt.Println()
+				}
+				printButtonGroup(group, buttons)
+				fmt.Println()
+			}
+		})
+	case "press":
+		press(PressAndRelease)
+	case "release":
+		press(Release)
+	default:
+		usage()
+	}
+}
+
+func doCacheCommand(client *Client, args []string) {
+	printSnapshot := func(snap *Snapshot) {
+		fmt.Println("Path:    ", client.CachePath)
+		fmt.Println("Host:    ", snap.Host)
+		fmt.Println("Revision:", snap.Revision)
+		fmt.Printf("Fetched:  %s (%s ago)\n", snap.FetchedAt.Format(time.RFC3339), time.Since(snap.FetchedAt).Round(time.Second))
+		fmt.Println()
+		fmt.Println("Areas:          ", len(snap.Areas))
+		fmt.Println("Zones:          ", len(snap.Zones))
+		fmt.Println("Devices:        ", len(snap.Devices))
+		fmt.Println("Button Groups:  ", len(snap.ButtonGroups))
+		fmt.Println("Buttons:        ", len(snap.Buttons))
+		fmt.Println("Virtual Buttons:", len(snap.VirtualButtons))
+	}
+
+	// summary is the cache's machine-readable form: counts rather than the
+	// full topology.
+	type summary struct {
+		Path           string
+		Host           string
+		Revision       string
+		FetchedAt      time.Time
+		Areas          int
+		Zones          int
+		Devices        int
+		ButtonGroups   int
+		Buttons        int
+		VirtualButtons int
+		Fresh          *bool `json:",omitempty"`
+	}
+	summarize := func(snap *Snapshot) summary {
+		return summary{
+			Path:           client.CachePath,
+			Host:           snap.Host,
+			Revision:       snap.Revision,
+			FetchedAt:      snap.FetchedAt,
+			Areas:          len(snap.Areas),
+			Zones:          len(snap.Zones),
+			Devices:        len(snap.Devices),
+			ButtonGroups:   len(snap.ButtonGroups),
+			Buttons:        len(snap.Buttons),
+			VirtualButtons: len(snap.VirtualButtons),
+		}
+	}
+
+	usage := func() {
+		fmt.Println("usage: tron cache show")
+		fmt.Println("       tron cache refresh")
+		fmt.Println("       tron cache clear")
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+
+	command := args[0]
+	switch command {
+	case "clear":
+		err := client.ClearCache()
+		if err != nil {
+			fmt.Println("error: failed to clear cache:", err)
+			os.Exit(1)
+		}
+	case "refresh":
+		snap, err := client.RefreshCacheContext(ctx)
+		if err != nil {
+			fmt.Println("error: failed to refresh cache:", err)
+			os.Exit(1)
+		}
+		render(summarize(snap), func() { printSnapshot(snap) })
+	case "show":
+		snap, err := LoadSnapshot(client.CachePath)
+		if errors.Is(err, os.ErrNotExist) {
+			render(nil, func() { fmt.Println("No cache at", client.CachePath) })
+			return
+		}
+		if err != nil {
+			fmt.Println("error: failed to read cache:", err)
+			os.Exit(1)
+		}
+		fresh, freshErr := client.SnapshotFreshContext(ctx, snap)
+		sum := summarize(snap)
+		if freshErr == nil {
+			sum.Fresh = &fresh
+		}
+		render(sum, func() {
+			printSnapshot(snap)
+			fmt.Println()
+			if freshErr != nil {
+				fmt.Printf("Fresh: unknown (%s)\n", freshErr)
+			} else {
+				fmt.Println("Fresh:", fresh)
+			}
+		})
+	default:
+		usage()
+	}
+}
+
+func doDiscoverCommand(config *Config, profile string, args []string) {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	wait := flags.Duration("wait", DefaultDiscoveryTimeout, "How long to wait for controllers to answer")
+	save := flags.Bool("save", false, "Write the chosen controller's host to the profile in ~/.tronrc")
+	flags.Parse(args)
+
+	list, err := DiscoverContext(ctx, *wait)
+	if err != nil {
+		fmt.Println("error: failed to discover controllers:", err)
+		os.Exit(1)
+	}
+
+	render(list, func() {
+		if len(list) == 0 {
+			fmt.Println("No controllers found")
+		}
+		for i, controller := range list {
+			fmt.Printf("%d. %s\n", i+1, controller.Host())
+			fmt.Println("   Addresses:", strings.Join(controller.Addrs, ", "))
+			if controller.Serial != "" {
+				fmt.Println("   Serial:   ", controller.Serial)
+			}
+			if controller.Model != "" {
+				fmt.Println("   Model:    ", controller.Model)
+			}
+		}
+	})
+
+	if !*save {
+		return
+	}
+
+	if len(list) == 0 {
+		fmt.Println("error: no controllers found")
+		os.Exit(1)
+	}
+
+	chosen := list[0]
+	if len(list) > 1 {
+		fmt.Printf("Controller to use [1-%d]: ", len(list))
+		var n int
+		_, err := fmt.Scanln(&n)
+		if err != nil || n < 1 || n > len(list) {
+			fmt.Println("error: invalid choice")
+			os.Exit(1)
+		}
+		chosen = list[n-1]
+	}
+
+	config.SetHost(profile, chosen.Host())
+	err = config.Save()
+	if err != nil {
+		fmt.Println("error: failed to save config:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved host %s to profile %s in %s\n", chosen.Host(), profile, config.Path)
+}
+
+func doCertCommand(client *Client, args []string) {
+	usage := func() {
+		fmt.Println("usage: tron cert show")
+		fmt.Println("       tron cert verify")
+		fmt.Println("       tron cert export [--password <password>] [--legacy] <file.pem|file.p12>")
+		fmt.Println("       tron cert import [--password <password>] <file>...")
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+
+	isPKCS12 := func(path string) bool {
+		ext := strings.ToLower(filepath.Ext(path))
+		return ext == ".p12" || ext == ".pfx"
+	}
+
+	command := args[0]
+	switch command {
+	case "export":
+		flags := flag.NewFlagSet("cert export", flag.ExitOnError)
+		password := flags.String("password", "", "Password to protect a PKCS#12 file with")
+		legacy := flags.Bool("legacy", false, "Use PKCS#12 encryption older tools can read")
+		flags.Parse(args[1:])
+		if flags.NArg() < 1 {
+			usage()
+		}
+		path := flags.Arg(0)
+
+		id, err := client.LoadIdentity()
+		if err != nil {
+			fmt.Println("error: failed to read certificates:", err)
+			os.Exit(1)
+		}
+
+		var out []byte
+		if isPKCS12(path) {
+			out, err = id.EncodePKCS12(*password, *legacy)
+		} else {
+			out, err = id.EncodePEM()
+		}
+		if err != nil {
+			fmt.Println("error: failed to encode certificates:", err)
+			os.Exit(1)
+		}
+
+		err = os.WriteFile(path, out, 0600)
+		if err != nil {
+			fmt.Println("error: failed to write file:", err)
+			os.Exit(1)
+		}
+	case "import":
+		flags := flag.NewFlagSet("cert import", flag.ExitOnError)
+		password := flags.String("password", "", "Password for a PKCS#12 file")
+		flags.Parse(args[1:])
+		if flags.NArg() < 1 {
+			usage()
+		}
+
+		files := [][]byte{}
+		for _, path := range flags.Args() {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Println("error: failed to read file:", err)
+				os.Exit(1)
+			}
+			files = append(files, raw)
+		}
+
+		id, err := DecodeIdentity(files, *password)
+		if err != nil {
+			fmt.Println("error: failed to import certificates:", err)
+			os.Exit(1)
+		}
+
+		err = client.SaveIdentity(id)
+		if err != nil {
+			fmt.Println("error: failed to save certificates:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %s. Run `tron cert verify` to check it.\n", id.Cert.Subject)
+	case "show":
+		type certificate struct {
+			Name string
+			CertificateInfo
+			ExpiresSoon bool
+		}
+
+		list := []certificate{}
+		for _, c := range []struct{ name, path string }{
+			{"Client Certificate", client.ClientCertPath},
+			{"CA Certificate", client.CACertPath},
+		} {
+			info, err := LoadCertificateInfo(c.path)
+			if err != nil {
+				fmt.Println("error: failed to read certificate:", err)
+				os.Exit(1)
+			}
+			list = append(list, certificate{
+				Name:            c.name,
+				CertificateInfo: info,
+				ExpiresSoon:     info.ExpiresWithin(CertificateExpiryWarning),
+			})
+		}
+
+		render(list, func() {
+			for i, cert := range list {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("%s (%s)\n", cert.Name, cert.Path)
+				fmt.Println("  Subject:    ", cert.Subject)
+				fmt.Println("  Issuer:     ", cert.Issuer)
+				fmt.Println("  Not Before: ", cert.NotBefore.Format(time.RFC3339))
+				fmt.Println("  Not After:  ", cert.NotAfter.Format(time.RFC3339))
+				fmt.Println("  Fingerprint:", cert.Fingerprint)
+			}
+		})
+
+		for _, cert := range list {
+			if !cert.ExpiresSoon {
+				continue
+			}
+			days := int(time.Until(cert.NotAfter).Hours() / 24)
+			if days < 0 {
+				fmt.Fprintf(os.Stderr, "warning: the %s expired %d days ago; run `tron pair` to get a new one\n", strings.ToLower(cert.Name), -days)
+			} else {
+				fmt.Fprintf(os.Stderr, "warning: the %s expires in %d days; run `tron pair` to get a new one\n", strings.ToLower(cert.Name), days)
+			}
+		}
+	case "verify":
+		state, err := client.VerifyIdentityContext(ctx)
+		if err != nil {
+			fmt.Println("error: failed to verify certificates:", err)
+			os.Exit(1)
+		}
+
+		peer := state.PeerCertificates[0]
+		type result struct {
+			Host        string
+			TLSVersion  string
+			Controller  string
+			Fingerprint string
+		}
+		res := result{
+			Host:        client.Host,
+			TLSVersion:  tlsVersionName(state.Version),
+			Controller:  peer.Subject.String(),
+			Fingerprint: Fingerprint(peer.Raw),
+		}
+		render(res, func() {
+			fmt.Printf("OK (%s)\n", res.TLSVersion)
+			fmt.Println("Controller: ", res.Controller)
+			fmt.Println("Fingerprint:", res.Fingerprint)
+		})
+	default:
+		usage()
+	}
+}
+
+func doDeviceCommand(client *Client, args []string) {
+	printDevice := func(device DeviceDefinition) {
+		fmt.Println("Name:         ", strings.Join(device.FullyQualifiedName, " "))
+		fmt.Println("Path:         ", device.Href)
+		fmt.Println("Type:         ", device.DeviceType)
+		fmt.Println("Model Number: ", device.ModelNumber)
+		fmt.Println("Serial Number:", device.SerialNumber)
+		fmt.Println()
+		fmt.Println("Addressed State:", device.AddressedState)
+		fmt.Println("Associated Area:", device.AssociatedArea.Href)
+		fmt.Println("Parent Path:    ", device.Parent.Href)
+		fmt.Println()
+		if len(device.LocalZones) > 0 {
+			fmt.Println("Local Zones:")
+			for _, lz := range device.LocalZones {
+				fmt.Println("-", lz.Href)
+			}
+		}
+		fmt.Println()
+		if len(device.ButtonGroups) > 0 {
+			fmt.Println("Button Groups:")
+			for _, bg := range device.ButtonGroups {
+				fmt.Println("-", bg.Href)
+			}
+		}
+		fmt.Println()
+		if len(device.DeviceRules) > 0 {
+			fmt.Println("Device Rules:")
+			for _, dr := range device.DeviceRules {
+				fmt.Println("-", dr.Href)
+			}
+		}
+		fmt.Println()
+		if len(device.LinkNodes) > 0 {
+			fmt.Println("Link Nodes:")
+			for _, ln := range device.LinkNodes {
+				fmt.Println("-", ln.Href)
+			}
+		}
+	}
+
+	usage := func() {
+		fmt.Println("usage: tron device list")
+		fmt.Println("       tron device info <id|name>")
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+
+	command := args[0]
+	switch command {
+	case "info":
+		if len(args) < 2 {
+			usage()
+		}
+		id := resolveID("device", client.ResolveDeviceContext, args[1])
+		device, err := client.DeviceContext(ctx, id)
+		if err != nil {
+			fmt.Println("error: failed to retrieve device info:", err)
+			os.Exit(1)
+		}
+		render(device, func() { printDevice(device) })
+	case "list":
+		list, err := client.DevicesContext(ctx)
+		if err != nil {
+			fmt.Println("error: failed retrieve device list:", err)
+			os.Exit(1)
+		}
+		render(list, func() {
+			first := true
+			for _, device := range list {
+				if first {
+					first = false
+				} else {
+					fmt.Println("==========")
+					fmt.Println()
+				}
+				printDevice(device)
+				fmt.Println()
+			}
+		})
+	default:
+		usage()
+	}
+}
+
+func doPairCommand(client *Client, args []string) {
+	flags := flag.NewFlagSet("pair", flag.ExitOnError)
+	name := flags.String("name", "tron", "Name to show in the controller's list of paired clients")
+	uid := flags.String("uid", "000000000000", "Device UID to pair as")
+	role := flags.String("role", "Admin", "Role to request")
+	wait := flags.Duration("wait", 2*time.Minute, "How long to wait for the button press")
+	flags.Parse(args)
+
+	err := client.PairContext(ctx, PairOptions{
+		DisplayName: *name,
+		DeviceUID:   *uid,
+		Role:        *role,
+		Timeout:     *wait,
+	})
+	if err != nil {
+		fmt.Println("error: failed to pair controller:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Paired with", client.Host)
+}
+
+func doProfileCommand(config *Config, current string, args []string) {
+	usage := func() {
+		fmt.Println("usage: tron profile list")
+		fmt.Println("       tron profile add <name> <host>")
+		fmt.Println("       tron profile remove <name>")
+		fmt.Println("       tron profile use <name>")
 		os.Exit(1)
 	}
 
@@ -156,85 +974,73 @@ func doAreaCommand(client Client, args []string) {
 		usage()
 	}
 
+	save := func() {
+		err := config.Save()
+		if err != nil {
+			fmt.Println("error: failed to save config:", err)
+			os.Exit(1)
+		}
+	}
+
 	command := args[0]
 	switch command {
-	case "info":
-		if len(args) < 2 {
+	case "add":
+		if len(args) < 3 {
 			usage()
 		}
-		id := args[1]
-		area, err := client.Area(id)
+		err := config.AddProfile(args[1], args[2])
 		if err != nil {
-			fmt.Println("error: failed to retrieve area info:", err)
+			fmt.Println("error: failed to add profile:", err)
 			os.Exit(1)
 		}
-		printArea(area)
+		save()
+		fmt.Printf("Added profile %s. Run `tron -p %s pair` to pair with it.\n", args[1], args[1])
 	case "list":
-		list, err := client.Areas()
+		list := config.Profiles()
+		render(list, func() {
+			for _, profile := range list {
+				marker := " "
+				if profile.Name == current {
+					marker = "*"
+				}
+				fmt.Printf("%s %s (%s)\n", marker, profile.Name, profile.Host)
+			}
+		})
+	case "remove":
+		if len(args) < 2 {
+			usage()
+		}
+		profile, err := config.Profile(args[1])
 		if err != nil {
-			fmt.Println("error: failed retrieve area list:", err)
+			fmt.Println("error: failed to remove profile:", err)
 			os.Exit(1)
 		}
-		first := true
-		for _, area := range list {
-			if first {
-				first = false
-			} else {
-				fmt.Println("==========")
-				fmt.Println()
-			}
-			printArea(area)
-			fmt.Println()
+		err = config.RemoveProfile(args[1])
+		if err != nil {
+			fmt.Println("error: failed to remove profile:", err)
+			os.Exit(1)
+		}
+		save()
+		fmt.Printf("Removed profile %s. Its certificates are still in %s.\n", profile.Name, filepath.Dir(profile.ClientCertPath))
+	case "use":
+		if len(args) < 2 {
+			usage()
+		}
+		err := config.UseProfile(args[1])
+		if err != nil {
+			fmt.Println("error: failed to switch profile:", err)
+			os.Exit(1)
 		}
+		save()
 	default:
 		usage()
 	}
 }
 
-func doDeviceCommand(client Client, args []string) {
-	printDevice := func(device DeviceDefinition) {
-		fmt.Println("Name:         ", strings.Join(device.FullyQualifiedName, " "))
-		fmt.Println("Path:         ", device.Href)
-		fmt.Println("Type:         ", device.DeviceType)
-		fmt.Println("Model Number: ", device.ModelNumber)
-		fmt.Println("Serial Number:", device.SerialNumber)
-		fmt.Println()
-		fmt.Println("Addressed State:", device.AddressedState)
-		fmt.Println("Associated Area:", device.AssociatedArea.Href)
-		fmt.Println("Parent Path:    ", device.Parent.Href)
-		fmt.Println()
-		if len(device.LocalZones) > 0 {
-			fmt.Println("Local Zones:")
-			for _, lz := range device.LocalZones {
-				fmt.Println("-", lz.Href)
-			}
-		}
-		fmt.Println()
-		if len(device.ButtonGroups) > 0 {
-			fmt.Println("Button Groups:")
-			for _, bg := range device.ButtonGroups {
-				fmt.Println("-", bg.Href)
-			}
-		}
-		fmt.Println()
-		if len(device.DeviceRules) > 0 {
-			fmt.Println("Device Rules:")
-			for _, dr := range device.DeviceRules {
-				fmt.Println("-", dr.Href)
-			}
-		}
-		fmt.Println()
-		if len(device.LinkNodes) > 0 {
-			fmt.Println("Link Nodes:")
-			for _, ln := range device.LinkNodes {
-				fmt.Println("-", ln.Href)
-			}
-		}
-	}
-
+func doSceneCommand(client *Client, args []string) {
 	usage := func() {
-		fmt.Println("usage: tron device list")
-		fmt.Println("       tron device info <id>")
+		fmt.Println("usage: tron scene list")
+		fmt.Println("       tron scene activate <id|name>")
 		os.Exit(1)
 	}
 
@@ -244,40 +1050,33 @@ func doDeviceCommand(client Client, args []string) {
 
 	command := args[0]
 	switch command {
-	case "info":
+	case "activate":
 		if len(args) < 2 {
 			usage()
 		}
-		id := args[1]
-		device, err := client.Device(id)
+		scene := strings.Join(args[1:], " ")
+		err := client.ActivateSceneContext(ctx, scene)
 		if err != nil {
-			fmt.Println("error: failed to retrieve device info:", err)
+			fmt.Println("error: failed to activate scene:", err)
 			os.Exit(1)
 		}
-		printDevice(device)
 	case "list":
-		list, err := client.Devices()
+		list, err := client.ScenesContext(ctx)
 		if err != nil {
-			fmt.Println("error: failed retrieve device list:", err)
+			fmt.Println("error: failed to retrieve scene list:", err)
 			os.Exit(1)
 		}
-		first := true
-		for _, device := range list {
-			if first {
-				first = false
-			} else {
-				fmt.Println("==========")
-				fmt.Println()
+		render(list, func() {
+			for _, scene := range list {
+				fmt.Printf("%s (%s)\n", scene.Name, scene.Href)
 			}
-			printDevice(device)
-			fmt.Println()
-		}
+		})
 	default:
 		usage()
 	}
 }
 
-func doServerCommand(client Client, args []string) {
+func doServerCommand(client *Client, args []string) {
 	printServer := func(server ServerDefinition) {
 		fmt.Println("Path:   ", server.Href)
 		fmt.Println("Type:   ", server.Type)
@@ -301,7 +1100,9 @@ func doServerCommand(client Client, args []string) {
 
 	usage := func() {
 		fmt.Println("usage: tron server list")
-		fmt.Println("usage: tron server info [id]")
+		fmt.Println("       tron server info [id]")
+		fmt.Println("       tron server pairings list")
+		fmt.Println("       tron server pairings revoke [--force] <href|name>")
 		os.Exit(1)
 	}
 
@@ -316,27 +1117,108 @@ func doServerCommand(client Client, args []string) {
 		if len(args) >= 2 {
 			id = args[1]
 		}
-		server, err := client.Server(id)
+		server, err := client.ServerContext(ctx, id)
 		if err != nil {
 			fmt.Println("error: failed to retrieve server info:", err)
 			os.Exit(1)
 		}
-		printServer(server)
+		render(server, func() { printServer(server) })
 	case "list":
-		list, err := client.Servers()
+		list, err := client.ServersContext(ctx)
 		if err != nil {
 			fmt.Println("error: failed to retrieve server list:", err)
 			os.Exit(1)
 		}
-		for _, server := range list {
-			printServer(server)
+		render(list, func() {
+			for _, server := range list {
+				printServer(server)
+			}
+		})
+	case "pairings":
+		if len(args) < 2 {
+			usage()
+		}
+		doPairingsCommand(client, args[1], args[2:], usage)
+	default:
+		usage()
+	}
+}
+
+func doPairingsCommand(client *Client, command string, args []string, usage func()) {
+	if command != "list" && command != "revoke" {
+		usage()
+	}
+
+	list, err := client.PairedClientsContext(ctx)
+	if err != nil {
+		fmt.Println("error: failed to retrieve pairing list:", err)
+		os.Exit(1)
+	}
+
+	switch command {
+	case "list":
+		render(list, func() {
+			for i, pairing := range list {
+				if i > 0 {
+					fmt.Println()
+				}
+				name := pairing.DisplayName
+				if pairing.Current {
+					name += " (this client)"
+				}
+				fmt.Printf("%s (%s)\n", name, pairing.Href)
+				fmt.Println("  Role:       ", pairing.Role)
+				fmt.Println("  Device UID: ", pairing.DeviceUID)
+				if pairing.Fingerprint != "" {
+					fmt.Println("  Fingerprint:", pairing.Fingerprint)
+				}
+			}
+		})
+	case "revoke":
+		flags := flag.NewFlagSet("server pairings revoke", flag.ExitOnError)
+		force := flags.Bool("force", false, "Revoke the pairing this client is using")
+		flags.Parse(args)
+		if flags.NArg() < 1 {
+			usage()
+		}
+		ref := strings.Join(flags.Args(), " ")
+
+		matches := []PairedClient{}
+		for _, pairing := range list {
+			if pairing.Href == ref || strings.EqualFold(pairing.DisplayName, ref) {
+				matches = append(matches, pairing)
+			}
+		}
+		if len(matches) == 0 {
+			fmt.Printf("error: no pairing matches %q\n", ref)
+			os.Exit(1)
+		}
+		if len(matches) > 1 {
+			fmt.Printf("error: %q matches %d pairings; use an href instead:\n", ref, len(matches))
+			for _, pairing := range matches {
+				fmt.Printf("  %s (%s)\n", pairing.DisplayName, pairing.Href)
+			}
+			os.Exit(1)
+		}
+
+		pairing := matches[0]
+		if pairing.Current && !*force {
+			fmt.Println("error: this is the pairing tron is using; pass --force to revoke it anyway")
+			os.Exit(1)
+		}
+
+		err := client.UnpairContext(ctx, pairing.Href)
+		if err != nil {
+			fmt.Println("error: failed to revoke pairing:", err)
+			os.Exit(1)
 		}
+		fmt.Printf("Revoked %s (%s)\n", pairing.DisplayName, pairing.Href)
 	default:
 		usage()
 	}
 }
 
-func doServiceCommand(client Client, args []string) {
+func doServiceCommand(client *Client, args []string) {
 	usage := func() {
 		fmt.Println("usage: tron service list")
 		os.Exit(1)
@@ -349,20 +1231,39 @@ func doServiceCommand(client Client, args []string) {
 	command := args[0]
 	switch command {
 	case "list":
-		list, err := client.Services()
+		list, err := client.ServicesContext(ctx)
 		if err != nil {
 			fmt.Println("error: failed retrieve service list:", err)
 			os.Exit(1)
 		}
-		for _, service := range list {
-			fmt.Printf("%s (%s)\n", service.Type, service.Href)
-		}
+		render(list, func() {
+			for _, service := range list {
+				fmt.Printf("%s (%s)\n", service.Type, service.Href)
+			}
+		})
 	default:
 		usage()
 	}
 }
 
-func doZoneCommand(client Client, args []string) {
+func doTreeCommand(client *Client, args []string) {
+	flags := flag.NewFlagSet("tree", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the tree as JSON (same as -o json)")
+	flags.Parse(args)
+	if *asJSON {
+		output.Format = "json"
+	}
+
+	tree, err := client.TreeContext(ctx)
+	if err != nil {
+		fmt.Println("error: failed to build project tree:", err)
+		os.Exit(1)
+	}
+
+	render(treeOutput(tree), func() { WriteTree(os.Stdout, tree) })
+}
+
+func doZoneCommand(client *Client, args []string) {
 	printZone := func(zone ZoneDefinition) {
 		fmt.Println("Name:", zone.Name)
 		fmt.Println("Path:", zone.Href)
@@ -377,11 +1278,17 @@ func doZoneCommand(client Client, args []string) {
 
 	usage := func() {
 		fmt.Println("usage: tron zone list")
-		fmt.Println("usage: tron zone info <id>")
-		fmt.Println("usage: tron zone status <id>")
-		fmt.Println("usage: tron zone on <id> [duration] [delay]")
-		fmt.Println("usage: tron zone off <id> [duration] [delay]")
-		fmt.Println("usage: tron zone dim <id> <level> [duration] [delay]")
+		fmt.Println("usage: tron zone info <id|name>")
+		fmt.Println("usage: tron zone status <id|name>")
+		fmt.Println("usage: tron zone on <id|name> [duration] [delay]")
+		fmt.Println("usage: tron zone off <id|name> [duration] [delay]")
+		fmt.Println("usage: tron zone dim <id|name> <level> [duration] [delay]")
+		fmt.Println("usage: tron zone color <id|name> --kelvin <k> | --hsv <h>,<s>[,<v>] [--level <level>]")
+		fmt.Println("                                 [--vibrancy <n>] [--duration <duration>] [--delay <delay>]")
+		fmt.Println("usage: tron zone fan <id|name> off|low|medium|mediumhigh|high")
+		fmt.Println("usage: tron zone shade <id|name> up|down|stop")
+		fmt.Println("usage: tron zone shade <id|name> level <level> [tilt <tilt>]")
+		fmt.Println("usage: tron zone shade <id|name> tilt <tilt>")
 		os.Exit(1)
 	}
 
@@ -391,11 +1298,63 @@ func doZoneCommand(client Client, args []string) {
 
 	command := args[0]
 	switch command {
+	case "color":
+		if len(args) < 2 {
+			usage()
+		}
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
+		flags := flag.NewFlagSet("zone color", flag.ExitOnError)
+		kelvin := flags.Int("kelvin", 0, "Color temperature in Kelvin")
+		hsv := flags.String("hsv", "", "Hue (0-360), saturation (0-100) and optional value (0-100)")
+		level := flags.Int("level", -1, "Brightness (0-100)")
+		vibrancy := flags.Int("vibrancy", -1, "Vibrancy (0-100)")
+		duration := flags.String("duration", "", "Fade duration")
+		delay := flags.String("delay", "", "Delay before fading")
+		flags.Parse(args[2:])
+		options := ColorOptions{
+			Delay:    *delay,
+			Duration: *duration,
+			Kelvin:   *kelvin,
+		}
+		if *level >= 0 {
+			options.Level = level
+		}
+		if *vibrancy >= 0 {
+			options.Vibrancy = vibrancy
+		}
+		if *hsv != "" {
+			parts := strings.Split(*hsv, ",")
+			if len(parts) < 2 || len(parts) > 3 {
+				fmt.Println("error: invalid HSV: expected <hue>,<saturation>[,<value>]")
+				os.Exit(1)
+			}
+			values := make([]int, len(parts))
+			for i, part := range parts {
+				n, err := strconv.Atoi(strings.TrimSpace(part))
+				if err != nil {
+					fmt.Println("error: invalid HSV:", err)
+					os.Exit(1)
+				}
+				values[i] = n
+			}
+			options.HSV = &HSVTuningLevel{
+				Hue:        values[0],
+				Saturation: values[1],
+			}
+			if len(values) == 3 && options.Level == nil {
+				options.Level = &values[2]
+			}
+		}
+		err := client.ZoneColorContext(ctx, id, options)
+		if err != nil {
+			fmt.Println("error: failed to set zone color:", err)
+			os.Exit(1)
+		}
 	case "dim":
 		if len(args) < 3 {
 			usage()
 		}
-		id := args[1]
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
 		level, err := strconv.Atoi(args[2])
 		if err != nil {
 			fmt.Println("error: invalid level:", err)
@@ -410,91 +1369,201 @@ func doZoneCommand(client Client, args []string) {
 		if len(args) >= 5 {
 			options.Delay = args[4]
 		}
-		_, err = client.ZoneDim(id, options)
+		_, err = client.ZoneDimContext(ctx, id, options)
 		if err != nil {
 			fmt.Println("error: failed to dim zone:", err)
 			os.Exit(1)
 		}
+	case "fan":
+		if len(args) < 3 {
+			usage()
+		}
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
+		speed, err := ParseFanSpeed(args[2])
+		if err != nil {
+			fmt.Println("error: invalid speed:", err)
+			os.Exit(1)
+		}
+		zone, err := client.ZoneContext(ctx, id)
+		if err != nil {
+			fmt.Println("error: failed to retrieve zone info:", err)
+			os.Exit(1)
+		}
+		if zone.ControlType != "FanSpeed" {
+			fmt.Printf("error: zone %s is not a fan (control type %s)\n", id, zone.ControlType)
+			os.Exit(1)
+		}
+		err = client.ZoneFanSpeedContext(ctx, id, speed)
+		if err != nil {
+			fmt.Println("error: failed to set fan speed:", err)
+			os.Exit(1)
+		}
 	case "info":
 		if len(args) < 2 {
 			usage()
 		}
-		id := args[1]
-		zone, err := client.Zone(id)
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
+		zone, err := client.ZoneContext(ctx, id)
 		if err != nil {
 			fmt.Println("error: failed to retrieve zone info:", err)
 			os.Exit(1)
 		}
-		printZone(zone)
+		render(zone, func() { printZone(zone) })
 	case "list":
-		list, err := client.Zones()
+		list, err := client.ZonesContext(ctx)
 		if err != nil {
 			fmt.Println("error: failed retrieve zone list:", err)
 			os.Exit(1)
 		}
-		for _, zone := range list {
-			printZone(zone)
-			fmt.Println()
-		}
+		render(list, func() {
+			for _, zone := range list {
+				printZone(zone)
+				fmt.Println()
+			}
+		})
 	case "on":
 		if len(args) < 2 {
 			usage()
 		}
-		id := args[1]
-		options := DimOptions{
-			Level: 100,
-		}
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
+		options := DimOptions{}
 		if len(args) >= 3 {
 			options.Duration = args[2]
 		}
 		if len(args) >= 4 {
 			options.Delay = args[3]
 		}
-		_, err := client.ZoneDim(id, options)
+		err := client.ZoneOnContext(ctx, id, options)
 		if err != nil {
-			fmt.Println("error: failed to dim zone:", err)
+			fmt.Println("error: failed to turn zone on:", err)
 			os.Exit(1)
 		}
 	case "off":
 		if len(args) < 2 {
 			usage()
 		}
-		id := args[1]
-		options := DimOptions{
-			Level: 0,
-		}
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
+		options := DimOptions{}
 		if len(args) >= 3 {
 			options.Duration = args[2]
 		}
 		if len(args) >= 4 {
 			options.Delay = args[3]
 		}
-		_, err := client.ZoneDim(id, options)
+		err := client.ZoneOffContext(ctx, id, options)
 		if err != nil {
-			fmt.Println("error: failed to dim zone:", err)
+			fmt.Println("error: failed to turn zone off:", err)
+			os.Exit(1)
+		}
+	case "shade":
+		if len(args) < 3 {
+			usage()
+		}
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
+		zone, err := client.ZoneContext(ctx, id)
+		if err != nil {
+			fmt.Println("error: failed to retrieve zone info:", err)
+			os.Exit(1)
+		}
+		if !IsShadeControlType(zone.ControlType) {
+			fmt.Printf("error: zone %s is not a shade (control type %s)\n", id, zone.ControlType)
+			os.Exit(1)
+		}
+		requireControlType := func(controlTypes ...string) {
+			for _, ct := range controlTypes {
+				if zone.ControlType == ct {
+					return
+				}
+			}
+			fmt.Printf("error: %s zones do not support %s\n", zone.ControlType, args[2])
+			os.Exit(1)
+		}
+		parseInt := func(name string, arg string) int {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Printf("error: invalid %s: %s\n", name, err)
+				os.Exit(1)
+			}
+			return n
+		}
+		switch args[2] {
+		case "up":
+			err = client.ZoneShadeRaiseContext(ctx, id)
+		case "down":
+			err = client.ZoneShadeLowerContext(ctx, id)
+		case "stop":
+			err = client.ZoneShadeStopContext(ctx, id)
+		case "level":
+			if len(args) < 4 {
+				usage()
+			}
+			level := parseInt("level", args[3])
+			requireControlType("Shade", "ShadeWithTilt")
+			if len(args) >= 6 && args[4] == "tilt" {
+				requireControlType("ShadeWithTilt")
+				tilt := parseInt("tilt", args[5])
+				err = client.ZoneShadeLevelWithTiltContext(ctx, id, level, tilt)
+			} else if len(args) == 4 {
+				err = client.ZoneShadeLevelContext(ctx, id, level)
+			} else {
+				usage()
+			}
+		case "tilt":
+			if len(args) < 4 {
+				usage()
+			}
+			tilt := parseInt("tilt", args[3])
+			requireControlType("ShadeWithTilt", "Tilt")
+			err = client.ZoneShadeTiltContext(ctx, id, tilt)
+		default:
+			usage()
+		}
+		if err != nil {
+			fmt.Println("error: failed to move shade:", err)
 			os.Exit(1)
 		}
 	case "status":
 		if len(args) < 2 {
 			usage()
 		}
-		id := args[1]
-		zoneStatus, err := client.ZoneStatus(id)
+		id := resolveID("zone", client.ResolveZoneContext, args[1])
+		zoneStatus, err := client.ZoneStatusContext(ctx, id)
 		if err != nil {
 			fmt.Println("error: failed to retrieve zone status:", err)
 			os.Exit(1)
 		}
-		fmt.Println("Level:   ", zoneStatus.Level)
-		fmt.Println("Accuracy:", zoneStatus.StatusAccuracy)
-		fmt.Println()
-		fmt.Println("Status Path:", zoneStatus.Href)
-		fmt.Println("Zone Path:  ", zoneStatus.Zone.Href)
+		render(zoneStatus, func() {
+			fmt.Println("Level:   ", zoneStatus.Level)
+			if zoneStatus.SwitchedLevel != "" {
+				fmt.Println("Switched:", zoneStatus.SwitchedLevel)
+			}
+			if zoneStatus.CCOLevel != "" {
+				fmt.Println("CCO:     ", zoneStatus.CCOLevel)
+			}
+			if zoneStatus.FanSpeed != "" {
+				fmt.Println("Fan:     ", zoneStatus.FanSpeed)
+			}
+			if white := zoneStatus.ColorTuningStatus.WhiteTuningLevel; white != nil {
+				fmt.Println("Kelvin:  ", white.Kelvin)
+			}
+			if hsv := zoneStatus.ColorTuningStatus.HSVTuningLevel; hsv != nil {
+				fmt.Println("Hue:     ", hsv.Hue)
+				fmt.Println("Saturation:", hsv.Saturation)
+			}
+			if zoneStatus.Vibrancy != 0 {
+				fmt.Println("Vibrancy:", zoneStatus.Vibrancy)
+			}
+			fmt.Println("Accuracy:", zoneStatus.StatusAccuracy)
+			fmt.Println()
+			fmt.Println("Status Path:", zoneStatus.Href)
+			fmt.Println("Zone Path:  ", zoneStatus.Zone.Href)
+		})
 	default:
 		usage()
 	}
 }
 
-func doGetCommand(client Client, args []string) {
+func doGetCommand(client *Client, args []string) {
 	usage := func() {
 		fmt.Println("usage: tron get <path>")
 		os.Exit(1)
@@ -505,24 +1574,45 @@ func doGetCommand(client Client, args []string) {
 	}
 
 	path := args[0]
-	res, err := client.Get(path)
+	res, err := client.GetContext(ctx, path)
 	if err != nil {
 		fmt.Println("error: request failed:", err)
 		os.Exit(1)
 	}
 
-	out, err := json.MarshalIndent(res, "", "  ")
+	renderResponse(res)
+}
+
+func doPostCommand(client *Client, args []string) {
+	usage := func() {
+		fmt.Println("usage: tron post <path> <json>")
+		os.Exit(1)
+	}
+
+	if len(args) < 2 {
+		usage()
+	}
+
+	path := args[0]
+	raw := args[1]
+	var o map[string]any
+	err := json.Unmarshal([]byte(raw), &o)
+	if err != nil {
+		fmt.Println("error: failed to parse input as JSON:", err)
+		os.Exit(1)
+	}
+	res, err := client.PostContext(ctx, path, o)
 	if err != nil {
-		fmt.Println("error: failed to format response as JSON:", err)
+		fmt.Println("error: request failed:", err)
 		os.Exit(1)
 	}
 
-	fmt.Println(string(out))
+	renderResponse(res)
 }
 
-func doPostCommand(client Client, args []string) {
+func doPutCommand(client *Client, args []string) {
 	usage := func() {
-		fmt.Println("usage: tron post <path> <json>")
+		fmt.Println("usage: tron put <path> <json>")
 		os.Exit(1)
 	}
 
@@ -538,17 +1628,91 @@ func doPostCommand(client Client, args []string) {
 		fmt.Println("error: failed to parse input as JSON:", err)
 		os.Exit(1)
 	}
-	res, err := client.Post(path, o)
+	res, err := client.PutContext(ctx, path, o)
+	if err != nil {
+		fmt.Println("error: request failed:", err)
+		os.Exit(1)
+	}
+
+	renderResponse(res)
+}
+
+func doDeleteCommand(client *Client, args []string) {
+	usage := func() {
+		fmt.Println("usage: tron delete <path>")
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+
+	path := args[0]
+	res, err := client.DeleteContext(ctx, path)
 	if err != nil {
 		fmt.Println("error: request failed:", err)
 		os.Exit(1)
 	}
 
-	out, err := json.MarshalIndent(res, "", "  ")
+	renderResponse(res)
+}
+
+func doWatchCommand(client *Client, args []string) {
+	usage := func() {
+		fmt.Println("usage: tron watch <path>")
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		usage()
+	}
+
+	// Keep watching across controller reboots and network blips.
+	var connected atomic.Bool
+	client.Reconnect = &ReconnectPolicy{
+		OnEvent: func(e ConnectionEvent) {
+			switch e.State {
+			case Connected:
+				if connected.Swap(true) {
+					fmt.Fprintln(os.Stderr, "reconnected to controller")
+				}
+			case Reconnecting:
+				fmt.Fprintf(os.Stderr, "connection lost (%v); reconnecting in %s (attempt %d)\n", e.Err, e.Delay.Round(time.Millisecond), e.Attempt)
+			case Failed:
+				fmt.Fprintln(os.Stderr, "error: failed to reconnect:", e.Err)
+			}
+		},
+	}
+
+	path := args[0]
+	updates, err := client.SubscribeContext(ctx, path)
 	if err != nil {
-		fmt.Println("error: failed to format response as JSON:", err)
+		fmt.Println("error: subscription failed:", err)
 		os.Exit(1)
 	}
 
-	fmt.Println(string(out))
+	// With -timeout, watching stops once it has passed.
+	for {
+		var res Response
+		var ok bool
+		select {
+		case res, ok = <-updates:
+		case <-ctx.Done():
+			return
+		}
+		if !ok {
+			break
+		}
+
+		out, err := json.Marshal(res)
+		if err != nil {
+			fmt.Println("error: failed to format response as JSON:", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(out))
+	}
+
+	fmt.Println("error: connection to controller closed")
+	os.Exit(1)
 }
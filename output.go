@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var outputFormats = []string{"json", "yaml", "table", "tsv"}
+
+// Output writes command results in the format selected with `-o`. With no
+// format selected, commands print their own human-readable text.
+type Output struct {
+	Format  string
+	Columns []string
+
+	w io.Writer
+}
+
+// tabular is implemented by values that are nested (like the project tree)
+// and need to be flattened into rows before being printed as a table.
+type tabular interface {
+	rows() any
+}
+
+// Render writes v in the selected format. If no format was selected, text is
+// called to print the default output instead.
+func (o *Output) Render(v any, text func()) error {
+	w := o.w
+	if w == nil {
+		w = os.Stdout
+	}
+
+	switch o.Format {
+	case "":
+		text()
+		return nil
+	case "json":
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "yaml":
+		return writeYAML(w, v)
+	case "table", "tsv":
+		if t, ok := v.(tabular); ok {
+			v = t.rows()
+		}
+		header, rows := flattenRows(v)
+		if len(header) == 0 {
+			// Nothing to print, e.g. a missing value.
+			return nil
+		}
+		header, rows = selectColumns(header, rows, o.Columns)
+		if o.Format == "tsv" {
+			return writeTSV(w, header, rows)
+		}
+		return writeTable(w, header, rows)
+	default:
+		return fmt.Errorf("unknown output format %q (expected one of %s)", o.Format, strings.Join(outputFormats, ", "))
+	}
+}
+
+// writeYAML writes v as YAML, keeping the field names and order it has as
+// JSON.
+func writeYAML(w io.Writer, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	err = yaml.Unmarshal(raw, &node)
+	if err != nil {
+		return err
+	}
+	resetStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err = enc.Encode(&node)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// resetStyle switches a node parsed from JSON from flow style to block style.
+func resetStyle(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		node.Style = 0
+	} else if node.Kind == yaml.ScalarNode && node.Style == yaml.DoubleQuotedStyle {
+		node.Style = 0
+	}
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeTSV(w io.Writer, header []string, rows [][]string) error {
+	clean := strings.NewReplacer("\t", " ", "\n", " ")
+	line := func(cells []string) error {
+		escaped := make([]string, len(cells))
+		for i, cell := range cells {
+			escaped[i] = clean.Replace(cell)
+		}
+		_, err := fmt.Fprintln(w, strings.Join(escaped, "\t"))
+		return err
+	}
+
+	err := line(header)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err = line(row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectColumns narrows the table to the requested columns, matched
+// case-insensitively. Unknown columns are printed empty.
+func selectColumns(header []string, rows [][]string, columns []string) ([]string, [][]string) {
+	if len(columns) == 0 {
+		return header, rows
+	}
+
+	index := make([]int, len(columns))
+	for i, col := range columns {
+		index[i] = -1
+		for j, h := range header {
+			if strings.EqualFold(col, h) {
+				index[i] = j
+				break
+			}
+		}
+	}
+
+	selected := make([][]string, len(rows))
+	for r, row := range rows {
+		selected[r] = make([]string, len(columns))
+		for i, j := range index {
+			if j >= 0 {
+				selected[r][i] = row[j]
+			}
+		}
+	}
+
+	return columns, selected
+}
+
+// flattenRows turns a struct, map, or slice of them into table rows, one per
+// entity. Nested structs become dotted columns (e.g. `Category.Type`), hrefs
+// are printed as paths, and lists are joined with commas.
+func flattenRows(v any) ([]string, [][]string) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return []string{}, [][]string{}
+	}
+
+	items := []reflect.Value{rv}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		items = make([]reflect.Value, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i)
+		}
+	}
+
+	header := []string{}
+	seen := map[string]bool{}
+	records := []map[string]string{}
+	for _, item := range items {
+		record := map[string]string{}
+		cols := []string{}
+		flattenValue("", item, record, &cols)
+		for _, col := range cols {
+			if !seen[col] {
+				seen[col] = true
+				header = append(header, col)
+			}
+		}
+		records = append(records, record)
+	}
+
+	rows := make([][]string, len(records))
+	for i, record := range records {
+		rows[i] = make([]string, len(header))
+		for j, col := range header {
+			rows[i][j] = record[col]
+		}
+	}
+
+	return header, rows
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	hrefType = reflect.TypeOf(HrefObject{})
+)
+
+func flattenValue(name string, v reflect.Value, record map[string]string, cols *[]string) {
+	set := func(s string) {
+		if name == "" {
+			name = "Value"
+		}
+		if _, ok := record[name]; !ok {
+			*cols = append(*cols, name)
+		}
+		record[name] = s
+	}
+
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			set("")
+			return
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		set(v.Interface().(time.Time).Format(time.RFC3339))
+		return
+	}
+	if v.Type().ConvertibleTo(hrefType) && v.Kind() == reflect.Struct {
+		set(v.Convert(hrefType).Interface().(HrefObject).Href)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Anonymous {
+				flattenValue(name, v.Field(i), record, cols)
+				continue
+			}
+			flattenValue(joinColumn(name, columnName(field)), v.Field(i), record, cols)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			flattenValue(joinColumn(name, fmt.Sprint(key)), v.MapIndex(key), record, cols)
+		}
+	case reflect.Slice, reflect.Array:
+		cells := []string{}
+		for i := 0; i < v.Len(); i++ {
+			sub := map[string]string{}
+			subCols := []string{}
+			flattenValue("", v.Index(i), sub, &subCols)
+			parts := []string{}
+			for _, col := range subCols {
+				if sub[col] != "" {
+					parts = append(parts, sub[col])
+				}
+			}
+			cells = append(cells, strings.Join(parts, " "))
+		}
+		set(strings.Join(cells, ","))
+	default:
+		set(fmt.Sprint(v.Interface()))
+	}
+}
+
+// columnName returns the field's name as it appears in JSON output.
+func columnName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if tag != "" && tag != "-" {
+		return tag
+	}
+	return field.Name
+}
+
+func joinColumn(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
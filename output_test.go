@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type outputArea struct {
+	Href     string `json:"href"`
+	Name     string
+	Category struct {
+		Type string
+	}
+	Parent  HrefObject
+	Devices []HrefObject
+	Tags    map[string]string `json:",omitempty"`
+	Level   *int
+	Updated time.Time
+}
+
+func testAreas() []outputArea {
+	level := 40
+
+	kitchen := outputArea{Href: "/area/2", Name: "Kitchen", Level: &level}
+	kitchen.Category.Type = "Kitchen"
+	kitchen.Parent.Href = "/area/1"
+	kitchen.Devices = []HrefObject{{Href: "/device/2"}, {Href: "/device/3"}}
+	kitchen.Tags = map[string]string{"b": "2", "a": "1"}
+	kitchen.Updated = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	notes := outputArea{Href: "/area/3", Name: "Living\tRoom\nDownstairs"}
+
+	return []outputArea{kitchen, notes}
+}
+
+func TestFlattenRows(t *testing.T) {
+	header, rows := flattenRows(testAreas())
+
+	wantHeader := []string{"href", "Name", "Category.Type", "Parent", "Devices", "Tags.a", "Tags.b", "Level", "Updated"}
+	if !reflect.DeepEqual(header, wantHeader) {
+		t.Errorf("header = %v, want %v", header, wantHeader)
+	}
+
+	wantRows := [][]string{
+		{"/area/2", "Kitchen", "Kitchen", "/area/1", "/device/2,/device/3", "1", "2", "40", "2024-05-01T12:00:00Z"},
+		{"/area/3", "Living\tRoom\nDownstairs", "", "", "", "", "", "", "0001-01-01T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("rows = %q, want %q", rows, wantRows)
+	}
+
+	// A single value is one row.
+	header, rows = flattenRows(&testAreas()[0])
+	if len(header) != len(wantHeader) || len(rows) != 1 {
+		t.Errorf("single value flattened to %v, %v", header, rows)
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	header := []string{"href", "Name", "Category.Type"}
+	rows := [][]string{{"/area/2", "Kitchen", "Kitchen"}}
+
+	tests := []struct {
+		columns    []string
+		wantHeader []string
+		wantRows   [][]string
+	}{
+		{nil, header, rows},
+		{[]string{"name", "HREF"}, []string{"name", "HREF"}, [][]string{{"Kitchen", "/area/2"}}},
+		{[]string{"Category.Type", "Missing"}, []string{"Category.Type", "Missing"}, [][]string{{"Kitchen", ""}}},
+	}
+
+	for _, tt := range tests {
+		gotHeader, gotRows := selectColumns(header, rows, tt.columns)
+		if !reflect.DeepEqual(gotHeader, tt.wantHeader) || !reflect.DeepEqual(gotRows, tt.wantRows) {
+			t.Errorf("selectColumns(%v) = %v, %v, want %v, %v", tt.columns, gotHeader, gotRows, tt.wantHeader, tt.wantRows)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		format  string
+		columns []string
+		v       any
+		want    string
+	}{
+		{"tsv", []string{"Name", "href"}, testAreas(), "Name\thref\nKitchen\t/area/2\nLiving Room Downstairs\t/area/3\n"},
+		{"table", []string{"href", "Level"}, testAreas(), "href     Level\n/area/2  40\n/area/3  \n"},
+		{"json", nil, map[string]any{"Name": "Kitchen"}, "{\n  \"Name\": \"Kitchen\"\n}\n"},
+		{"yaml", nil, struct {
+			Name   string
+			Parent HrefObject
+			Zones  []string
+		}{"Kitchen", HrefObject{Href: "/area/1"}, []string{"/zone/1"}}, "Name: Kitchen\nParent:\n  href: /area/1\nZones:\n  - /zone/1\n"},
+		{"json", nil, nil, "null\n"},
+		{"yaml", nil, nil, "null\n"},
+		{"table", nil, nil, ""},
+		{"tsv", nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		o := Output{Format: tt.format, Columns: tt.columns, w: &buf}
+		err := o.Render(tt.v, func() { t.Error("text output called") })
+		if err != nil {
+			t.Errorf("Render(%s, %v) error = %v", tt.format, tt.v, err)
+			continue
+		}
+		if buf.String() != tt.want {
+			t.Errorf("Render(%s, %v) =\n%s\nwant\n%s", tt.format, tt.v, buf.String(), tt.want)
+		}
+	}
+
+	called := false
+	o := Output{}
+	o.Render(testAreas(), func() { called = true })
+	if !called {
+		t.Error("default format didn't call the text output")
+	}
+
+	o = Output{Format: "xml"}
+	err := o.Render(testAreas(), func() {})
+	if err == nil || !strings.Contains(err.Error(), "unknown output format") {
+		t.Errorf("Render(xml) error = %v", err)
+	}
+}
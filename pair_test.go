@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paulrosania/tron/leaptest"
+)
+
+// newPairingClient returns a client for srv that hasn't paired yet.
+func newPairingClient(t *testing.T, srv *leaptest.Server) *Client {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "certs")
+	c := &Client{
+		Host:           srv.Host,
+		ControlPort:    srv.ControlPort,
+		PairingPort:    srv.PairingPort,
+		CACertPath:     filepath.Join(dir, "ca.crt"),
+		ClientCertPath: filepath.Join(dir, "client.crt"),
+		ClientKeyPath:  filepath.Join(dir, "client.key"),
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestPair(t *testing.T) {
+	srv := newTestServer(t)
+	c := newPairingClient(t, srv)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		srv.PressButton()
+	}()
+
+	err := c.Pair(PairOptions{DisplayName: "test", DeviceUID: "123456789abc", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(c.ClientKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key permissions = %v, want 0600", info.Mode().Perm())
+	}
+
+	id, err := c.LoadIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Cert.Subject.CommonName != "test" {
+		t.Errorf("certificate subject = %q, want %q", id.Cert.Subject.CommonName, "test")
+	}
+
+	clients, err := c.PairedClients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("got %d paired clients, want 1", len(clients))
+	}
+	if got := clients[0]; got.DisplayName != "test" || got.DeviceUID != "123456789abc" || got.Role != "Admin" || !got.Current {
+		t.Errorf("unexpected paired client: %+v", got)
+	}
+}
+
+func TestPairTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	c := newPairingClient(t, srv)
+
+	err := c.Pair(PairOptions{Timeout: 200 * time.Millisecond})
+	if !errors.Is(err, ErrPairingTimeout) {
+		t.Fatalf("Pair() error = %v, want ErrPairingTimeout", err)
+	}
+
+	for _, path := range []string{c.CACertPath, c.ClientCertPath, c.ClientKeyPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was written after a failed pairing", path)
+		}
+	}
+	if len(srv.Pairings()) != 0 {
+		t.Errorf("server recorded a pairing after a timeout")
+	}
+}
+
+func TestPairContextCancel(t *testing.T) {
+	srv := newTestServer(t)
+	c := newPairingClient(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	err := c.PairContext(ctx, PairOptions{Timeout: 5 * time.Second})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("PairContext() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestPairedClientsSorted(t *testing.T) {
+	srv := newTestServer(t)
+
+	var c *Client
+	for _, name := range []string{"zeta", "alpha", "mu"} {
+		c = newPairingClient(t, srv)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			srv.PressButton()
+		}()
+		err := c.Pair(PairOptions{DisplayName: name, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clients, err := c.PairedClients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, client := range clients {
+		names = append(names, client.DisplayName)
+	}
+	if len(names) != 3 || names[0] != "alpha" || names[1] != "mu" || names[2] != "zeta" {
+		t.Errorf("paired clients = %v, want [alpha mu zeta]", names)
+	}
+}
+
+func TestPairWithSession(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	_, err := c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		srv.PressButton()
+	}()
+	err = c.Pair(PairOptions{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the session with the new identity is left open.
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Connections() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections open after pairing, want 1", srv.Connections())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriteFilesAtomicRollback(t *testing.T) {
+	dir := t.TempDir()
+	files := []fileWrite{
+		{Path: filepath.Join(dir, "client.key"), Data: []byte("new key"), Perm: 0600},
+		{Path: filepath.Join(dir, "client.crt"), Data: []byte("new cert"), Perm: 0644},
+		{Path: filepath.Join(dir, "ca.crt"), Data: []byte("new ca"), Perm: 0644},
+	}
+	old := map[string]string{files[0].Path: "old key", files[1].Path: "old cert"}
+	for path, data := range old {
+		err := os.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Fail installing the last file, after the others are in place.
+	t.Cleanup(func() { rename = os.Rename })
+	rename = func(from string, to string) error {
+		if from == files[2].Path+".tmp" {
+			return errors.New("disk full")
+		}
+		return os.Rename(from, to)
+	}
+
+	err := writeFilesAtomic(files)
+	if err == nil {
+		t.Fatal("writeFilesAtomic() succeeded")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(old) {
+		t.Errorf("left %d files behind, want only the original %d", len(entries), len(old))
+	}
+	for path, want := range old {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(path), data, err, want)
+		}
+	}
+
+	// Without the failure, every file is replaced.
+	rename = os.Rename
+	err = writeFilesAtomic(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f.Path)
+		if err != nil || string(data) != string(f.Data) {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(f.Path), data, err, f.Data)
+		}
+	}
+	entries, _ = os.ReadDir(dir)
+	if len(entries) != len(files) {
+		t.Errorf("left %d files behind, want %d", len(entries), len(files))
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// PairedClient is an integration paired with the controller: an app, a
+// hub, or another copy of tron.
+type PairedClient struct {
+	Href        string `json:"href"`
+	DisplayName string
+	DeviceUID   string
+	Role        string
+
+	// Fingerprint is the SHA-256 fingerprint of the client's certificate, if
+	// the controller reports it.
+	Fingerprint string
+
+	// Current is true for the pairing this client is connected with.
+	Current bool
+}
+
+type pairingEntry struct {
+	Href        string
+	DisplayName string
+	DeviceUID   string
+	Role        string
+	Certificate string
+}
+
+// pairingListHref returns the path of the controller's pairing list.
+func (c *Client) pairingListHref(ctx context.Context) (string, error) {
+	servers, err := c.ServersContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, server := range servers {
+		if server.LEAPProperties.PairingList.Href != "" {
+			return server.LEAPProperties.PairingList.Href, nil
+		}
+	}
+
+	return "", errors.New("controller has no pairing list")
+}
+
+// PairedClients gets the clients paired with the controller, sorted by name.
+// Entries that the pairing list only references by href are read
+// individually.
+func (c *Client) PairedClients() ([]PairedClient, error) {
+	return c.PairedClientsContext(context.Background())
+}
+
+// PairedClientsContext is like PairedClients but uses the provided context.
+func (c *Client) PairedClientsContext(ctx context.Context) ([]PairedClient, error) {
+	href, err := c.pairingListHref(ctx)
+	if err != nil {
+		return []PairedClient{}, err
+	}
+
+	body, err := c.GetContext(ctx, href)
+	if err != nil {
+		return []PairedClient{}, err
+	}
+
+	var res struct {
+		PairingList struct {
+			Pairings []pairingEntry
+		}
+	}
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return []PairedClient{}, err
+	}
+	entries := res.PairingList.Pairings
+
+	current := ""
+	if cert, err := c.loadClientCertificate(); err == nil {
+		current = Fingerprint(cert.Certificate[0])
+	}
+
+	result := []PairedClient{}
+	for _, entry := range entries {
+		if entry.DisplayName == "" && entry.Role == "" && entry.Href != "" {
+			entry, err = c.pairingEntry(ctx, entry.Href)
+			if err != nil {
+				return []PairedClient{}, err
+			}
+		}
+
+		client := PairedClient{
+			Href:        entry.Href,
+			DisplayName: entry.DisplayName,
+			DeviceUID:   entry.DeviceUID,
+			Role:        entry.Role,
+			Fingerprint: certificateFingerprint(entry.Certificate),
+		}
+		client.Current = client.Fingerprint != "" && client.Fingerprint == current
+		result = append(result, client)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DisplayName != result[j].DisplayName {
+			return result[i].DisplayName < result[j].DisplayName
+		}
+		return result[i].Href < result[j].Href
+	})
+
+	return result, nil
+}
+
+// pairingEntry reads a single entry of the pairing list.
+func (c *Client) pairingEntry(ctx context.Context, href string) (pairingEntry, error) {
+	body, err := c.GetContext(ctx, href)
+	if err != nil {
+		return pairingEntry{}, err
+	}
+
+	var res struct {
+		Pairing pairingEntry
+	}
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return pairingEntry{}, err
+	}
+	if res.Pairing.Href == "" {
+		res.Pairing.Href = href
+	}
+
+	return res.Pairing, nil
+}
+
+// Unpair revokes a paired client's access to the controller. The href is one
+// returned by PairedClients.
+func (c *Client) Unpair(href string) error {
+	return c.UnpairContext(context.Background(), href)
+}
+
+// UnpairContext is like Unpair but uses the provided context.
+func (c *Client) UnpairContext(ctx context.Context, href string) error {
+	if href == "" {
+		return errors.New("no pairing href provided")
+	}
+
+	_, err := c.DeleteContext(ctx, href)
+	return err
+}
+
+// certificateFingerprint returns the fingerprint of a certificate reported as
+// PEM or as base64-encoded DER, or "" if it can't be read.
+func certificateFingerprint(cert string) string {
+	if cert == "" {
+		return ""
+	}
+
+	if block, _ := pem.Decode([]byte(cert)); block != nil {
+		return Fingerprint(block.Bytes)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cert))
+	if err != nil {
+		return ""
+	}
+	return Fingerprint(der)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// DefaultProfile is the profile stored in the root section of `.tronrc`,
+// which is where tron kept its settings before it supported profiles.
+const DefaultProfile = "default"
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Profile is the configuration for one controller.
+type Profile struct {
+	Name string
+	Host string
+
+	CACertPath     string
+	ClientCertPath string
+	ClientKeyPath  string
+
+	CachePath string
+}
+
+// Config is the user's `.tronrc`. Each named section is a profile, with the
+// following keys:
+//
+//	host         controller hostname or IP address
+//	certs        directory holding ca.crt, client.crt and client.key
+//	ca_cert      path to the CA certificate (overrides certs)
+//	client_cert  path to the client certificate (overrides certs)
+//	client_key   path to the client key (overrides certs)
+//	cache        path to the project cache
+//
+// The root section holds the default profile, and a `profile` key naming
+// the profile to use when none is given on the command line.
+type Config struct {
+	Path string
+
+	home string
+	file *ini.File
+}
+
+// LoadConfig reads the `.tronrc` in the home directory. A missing file is
+// treated as an empty one.
+func LoadConfig(home string) (*Config, error) {
+	path := filepath.Join(home, defaultConfigFile)
+	file, err := ini.LooseLoad(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{Path: path, home: home, file: file}, nil
+}
+
+// Save writes the config back to disk.
+func (c *Config) Save() error {
+	return c.file.SaveTo(c.Path)
+}
+
+// Current returns the name of the profile selected with `tron profile use`,
+// or the default profile.
+func (c *Config) Current() string {
+	name := value(c.file.Section(ini.DefaultSection), "profile")
+	if name == "" {
+		return DefaultProfile
+	}
+	return name
+}
+
+// Profiles returns the configured profiles. The default profile is included
+// if it has a host.
+func (c *Config) Profiles() []Profile {
+	profiles := []Profile{}
+	if c.file.Section(ini.DefaultSection).HasKey("host") {
+		profiles = append(profiles, c.profile(DefaultProfile))
+	}
+	for _, name := range c.file.SectionStrings() {
+		if name == ini.DefaultSection {
+			continue
+		}
+		profiles = append(profiles, c.profile(name))
+	}
+
+	return profiles
+}
+
+// Profile returns the named profile.
+func (c *Config) Profile(name string) (Profile, error) {
+	if !c.has(name) {
+		return Profile{}, fmt.Errorf("no profile named %q", name)
+	}
+
+	return c.profile(name), nil
+}
+
+// AddProfile creates a profile for the controller at host.
+func (c *Config) AddProfile(name string, host string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q (use letters, numbers, - and _)", name)
+	}
+	if name != DefaultProfile && c.has(name) {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+
+	c.SetHost(name, host)
+	return nil
+}
+
+// RemoveProfile deletes the named profile. Its certificates are left on disk.
+func (c *Config) RemoveProfile(name string) error {
+	if !c.has(name) {
+		return fmt.Errorf("no profile named %q", name)
+	}
+
+	if name == DefaultProfile {
+		c.file.Section(ini.DefaultSection).DeleteKey("host")
+	} else {
+		c.file.DeleteSection(name)
+	}
+	if c.Current() == name {
+		c.file.Section(ini.DefaultSection).DeleteKey("profile")
+	}
+
+	return nil
+}
+
+// UseProfile makes the named profile the one used by default.
+func (c *Config) UseProfile(name string) error {
+	if !c.has(name) {
+		return fmt.Errorf("no profile named %q", name)
+	}
+
+	if name == DefaultProfile {
+		c.file.Section(ini.DefaultSection).DeleteKey("profile")
+	} else {
+		c.file.Section(ini.DefaultSection).Key("profile").SetValue(name)
+	}
+
+	return nil
+}
+
+// SetHost sets the named profile's host, creating the profile if needed.
+func (c *Config) SetHost(name string, host string) {
+	c.section(name).Key("host").SetValue(host)
+}
+
+func (c *Config) has(name string) bool {
+	if name == DefaultProfile {
+		return true
+	}
+	_, err := c.file.GetSection(name)
+	return err == nil
+}
+
+func (c *Config) section(name string) *ini.Section {
+	if name == DefaultProfile {
+		return c.file.Section(ini.DefaultSection)
+	}
+	return c.file.Section(name)
+}
+
+// profile reads a profile's settings, filling in default paths. The default
+// profile keeps the paths tron used before profiles; other profiles get their
+// own directory under `~/.config/tron/profiles`.
+func (c *Config) profile(name string) Profile {
+	section := c.section(name)
+
+	certDir := filepath.Join(c.home, defaultCertDir)
+	cachePath := filepath.Join(c.home, defaultCacheFile)
+	if name != DefaultProfile {
+		certDir = filepath.Join(c.home, defaultProfileDir, name, "certs")
+		cachePath = filepath.Join(c.home, defaultProfileDir, name, "cache.json")
+	}
+	if dir := value(section, "certs"); dir != "" {
+		certDir = c.expand(dir)
+	}
+
+	path := func(key string, fallback string) string {
+		if p := value(section, key); p != "" {
+			return c.expand(p)
+		}
+		return fallback
+	}
+
+	return Profile{
+		Name: name,
+		Host: value(section, "host"),
+
+		CACertPath:     path("ca_cert", filepath.Join(certDir, "ca.crt")),
+		ClientCertPath: path("client_cert", filepath.Join(certDir, "client.crt")),
+		ClientKeyPath:  path("client_key", filepath.Join(certDir, "client.key")),
+
+		CachePath: path("cache", cachePath),
+	}
+}
+
+// expand resolves `~/` and paths relative to the home directory.
+func (c *Config) expand(path string) string {
+	if path == "~" {
+		return c.home
+	}
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(c.home, path[2:])
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(c.home, path)
+	}
+	return path
+}
+
+// value returns the key's value, or "" if it isn't set. Unlike Section.Key, it
+// doesn't add missing keys to the file.
+func value(section *ini.Section, key string) string {
+	if !section.HasKey(key) {
+		return ""
+	}
+	return section.Key(key).String()
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConnectionState is the state of a reconnecting client's connection.
+type ConnectionState string
+
+const (
+	// Connected is reported whenever a connection to the controller is
+	// established, including the first one.
+	Connected ConnectionState = "connected"
+	// Reconnecting is reported before each attempt to reconnect after the
+	// connection drops.
+	Reconnecting ConnectionState = "reconnecting"
+	// Failed is reported when the policy's attempts are used up. The
+	// client's subscriptions are closed.
+	Failed ConnectionState = "failed"
+)
+
+// ConnectionEvent reports a change in a reconnecting client's connection.
+type ConnectionEvent struct {
+	State ConnectionState
+
+	// Attempt is the number of the upcoming reconnection attempt, starting at
+	// 1, and Delay is how long the client waits before making it. Both are
+	// only set for Reconnecting events.
+	Attempt int
+	Delay   time.Duration
+
+	// Err is why the connection dropped or the last attempt failed.
+	Err error
+}
+
+// ReconnectPolicy configures how a client reconnects when its connection to
+// the controller drops. Attempts are spaced with jittered exponential
+// backoff: each delay is between half and all of the nominal delay, which
+// starts at InitialDelay and doubles up to MaxDelay.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration // default 1s
+	MaxDelay     time.Duration // default 1m
+
+	// MaxAttempts is how many times to try reconnecting before giving up. If
+	// zero, the client never gives up.
+	MaxAttempts int
+
+	// OnEvent, if set, is called with every change in the connection's
+	// state. It is called synchronously, so it shouldn't block.
+	OnEvent func(ConnectionEvent)
+}
+
+// reconnectTimeout bounds each reconnection attempt, and each subscription
+// re-issued after reconnecting.
+var reconnectTimeout = 30 * time.Second
+
+func (p *ReconnectPolicy) emit(event ConnectionEvent) {
+	if p.OnEvent != nil {
+		p.OnEvent(event)
+	}
+}
+
+// delay returns how long to wait before the given attempt.
+func (p *ReconnectPolicy) delay(attempt int) time.Duration {
+	initial := p.InitialDelay
+	if initial <= 0 {
+		initial = time.Second
+	}
+	max := p.MaxDelay
+	if max <= 0 {
+		max = time.Minute
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// subscription is a subscription on a reconnecting client, which outlives
+// the sessions it is issued on.
+type subscription struct {
+	path string
+	out  chan Response
+
+	issueMu sync.Mutex // serializes issuing it
+
+	// Guarded by Client.subsMu.
+	sess      *session      // the session it is currently issued on
+	done      chan struct{} // closed to stop forwarding
+	forwarder chan struct{} // closed when the current forwarder exits
+}
+
+// superviseConnection waits for the client's session to drop, then
+// reconnects, until stop is closed or the policy gives up. Subscriptions are
+// re-issued by session whenever it starts a new session, whoever dialed it.
+func (c *Client) superviseConnection(policy *ReconnectPolicy, stop chan struct{}) {
+	for {
+		c.mu.Lock()
+		sess := c.sess
+		c.mu.Unlock()
+		if sess == nil {
+			return
+		}
+
+		select {
+		case <-sess.done:
+		case <-stop:
+			return
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		sess.mu.Lock()
+		err := sess.err
+		sess.mu.Unlock()
+		if err == nil {
+			err = ErrSessionClosed
+		}
+
+		for attempt := 1; ; attempt++ {
+			// Another request may have reconnected in the meantime.
+			c.mu.Lock()
+			replaced := c.sess != nil && c.sess != sess && c.sess.alive()
+			c.mu.Unlock()
+			if replaced {
+				break
+			}
+
+			delay := policy.delay(attempt)
+			policy.emit(ConnectionEvent{State: Reconnecting, Attempt: attempt, Delay: delay, Err: err})
+
+			select {
+			case <-time.After(delay):
+			case <-stop:
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+			_, err = c.session(ctx)
+			cancel()
+			if err == nil {
+				break
+			}
+
+			if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+				c.mu.Lock()
+				if c.reconnectStop == stop {
+					c.reconnectStop = nil
+				}
+				c.mu.Unlock()
+
+				policy.emit(ConnectionEvent{State: Failed, Err: err})
+				c.endSubscriptions()
+				return
+			}
+		}
+	}
+}
+
+// resubscribeSession re-issues the client's subscriptions on a new session.
+// Subscriptions that couldn't be re-issued, e.g. because the controller
+// didn't answer in time, are retried until they are, or until the session
+// drops and they're re-issued on the next one.
+func (c *Client) resubscribeSession(policy *ReconnectPolicy, sess *session) {
+	for attempt := 1; !c.resubscribe(sess); attempt++ {
+		select {
+		case <-time.After(policy.delay(attempt)):
+		case <-sess.done:
+			return
+		}
+	}
+}
+
+// subscribeReconnecting subscribes to the path, and keeps the subscription
+// alive across reconnections.
+func (c *Client) subscribeReconnecting(ctx context.Context, path string) (<-chan Response, error) {
+	sub := &subscription{
+		path: path,
+		out:  make(chan Response, 16),
+		done: make(chan struct{}),
+	}
+
+	// The subscription is registered first, so that it is re-issued if the
+	// session is replaced while it is being issued.
+	c.subsMu.Lock()
+	if c.subs == nil {
+		c.subs = map[*subscription]bool{}
+	}
+	c.subs[sub] = true
+	c.subsMu.Unlock()
+
+	sess, err := c.session(ctx)
+	if err == nil {
+		err = c.issueSubscription(ctx, sess, sub)
+	}
+	if err != nil {
+		if c.removeSubscription(sub) {
+			c.endSubscription(sub)
+		}
+		return nil, err
+	}
+
+	return sub.out, nil
+}
+
+// issueSubscription sends the subscription's request on the session, and
+// forwards its updates to the subscription's channel until the session ends.
+// Subscriptions that are already on the session, or that have been removed,
+// are left alone.
+func (c *Client) issueSubscription(ctx context.Context, sess *session, sub *subscription) error {
+	sub.issueMu.Lock()
+	defer sub.issueMu.Unlock()
+
+	c.subsMu.Lock()
+	skip := !c.subs[sub] || sub.sess == sess
+	c.subsMu.Unlock()
+	if skip {
+		return nil
+	}
+
+	req := Request{
+		CommuniqueType: "SubscribeRequest",
+		Header: RequestHeader{
+			URL: sub.path,
+		},
+	}
+
+	res, updates, err := sess.subscribe(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(req.CommuniqueType, res)
+	if err != nil {
+		sess.unsubscribe(res)
+		return err
+	}
+
+	c.subsMu.Lock()
+	if !c.subs[sub] {
+		// The subscription was removed while it was being issued.
+		c.subsMu.Unlock()
+		sess.unsubscribe(res)
+		return nil
+	}
+	previous := sub.forwarder
+	forwarder := make(chan struct{})
+	sub.forwarder = forwarder
+	sub.sess = sess
+	c.subsMu.Unlock()
+
+	go func() {
+		defer close(forwarder)
+
+		// Let the previous session's forwarder finish first, so updates
+		// stay in order.
+		if previous != nil {
+			<-previous
+		}
+
+		for {
+			select {
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+				select {
+				case sub.out <- update:
+				case <-sub.done:
+					sess.unsubscribe(res)
+					return
+				}
+			case <-sub.done:
+				sess.unsubscribe(res)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// resubscribe re-issues the subscriptions that aren't on the session yet, and
+// reports whether they all were. Subscriptions the controller now rejects are
+// closed.
+func (c *Client) resubscribe(sess *session) bool {
+	c.subsMu.Lock()
+	subs := []*subscription{}
+	for sub := range c.subs {
+		if sub.sess != sess {
+			subs = append(subs, sub)
+		}
+	}
+	c.subsMu.Unlock()
+
+	ok := true
+	for _, sub := range subs {
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+		err := c.issueSubscription(ctx, sess, sub)
+		cancel()
+
+		var leapErr *LEAPError
+		if errors.As(err, &leapErr) {
+			if c.removeSubscription(sub) {
+				c.endSubscription(sub)
+			}
+		} else if err != nil {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// removeSubscription stops re-issuing the subscription, and reports whether
+// it was still on the client. Only the caller that removes a subscription
+// may end it.
+func (c *Client) removeSubscription(sub *subscription) bool {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	if !c.subs[sub] {
+		return false
+	}
+	delete(c.subs, sub)
+	return true
+}
+
+// endSubscriptions removes and closes every subscription on the client.
+func (c *Client) endSubscriptions() {
+	c.subsMu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.subsMu.Unlock()
+
+	for sub := range subs {
+		c.endSubscription(sub)
+	}
+}
+
+// endSubscription stops forwarding the subscription's updates and closes its
+// channel.
+func (c *Client) endSubscription(sub *subscription) {
+	c.subsMu.Lock()
+	close(sub.done)
+	forwarder := sub.forwarder
+	c.subsMu.Unlock()
+
+	if forwarder != nil {
+		<-forwarder
+	}
+	close(sub.out)
+}
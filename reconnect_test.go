@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/paulrosania/tron/leaptest"
+)
+
+// events records a reconnecting client's connection events.
+func events(c *Client, policy ReconnectPolicy) <-chan ConnectionEvent {
+	ch := make(chan ConnectionEvent, 32)
+	policy.OnEvent = func(e ConnectionEvent) { ch <- e }
+	c.Reconnect = &policy
+	return ch
+}
+
+func expectEvent(t *testing.T, ch <-chan ConnectionEvent, state ConnectionState) ConnectionEvent {
+	t.Helper()
+
+	select {
+	case e := <-ch:
+		if e.State != state {
+			t.Fatalf("got %s event (%v), want %s", e.State, e.Err, state)
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s event", state)
+	}
+	return ConnectionEvent{}
+}
+
+func expectLevel(t *testing.T, updates <-chan Response, level int) {
+	t.Helper()
+
+	select {
+	case res, ok := <-updates:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		var body OneZoneStatus
+		err := mapstructure.Decode(res.Body, &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body.ZoneStatus.Level != level {
+			t.Fatalf("level = %d, want %d", body.ZoneStatus.Level, level)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for zone status")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+	ch := events(c, ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+
+	updates, err := c.Subscribe("/zone/1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, ch, Connected)
+	expectLevel(t, updates, 0)
+
+	srv.DropConnections()
+	e := expectEvent(t, ch, Reconnecting)
+	if e.Attempt != 1 || e.Err == nil {
+		t.Errorf("unexpected reconnecting event: %+v", e)
+	}
+	expectEvent(t, ch, Connected)
+
+	// The subscription is re-issued on the new connection, and keeps
+	// receiving updates.
+	expectLevel(t, updates, 0)
+	srv.SetZoneLevel("/zone/1", 42)
+	expectLevel(t, updates, 42)
+
+	_, err = c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+	if _, ok := <-updates; ok {
+		t.Error("subscription still open after Close")
+	}
+}
+
+func TestReconnectFailed(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+	ch := events(c, ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxAttempts: 2})
+
+	updates, err := c.Subscribe("/zone/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, ch, Connected)
+	<-updates
+
+	srv.Close()
+	expectEvent(t, ch, Reconnecting)
+	expectEvent(t, ch, Reconnecting)
+	expectEvent(t, ch, Failed)
+
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("subscription still open after giving up")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the subscription to close")
+	}
+}
+
+func TestReconnectResubscribeRetry(t *testing.T) {
+	timeout := reconnectTimeout
+	reconnectTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { reconnectTimeout = timeout })
+
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+	ch := events(c, ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+
+	updates, err := c.Subscribe("/zone/1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, ch, Connected)
+	expectLevel(t, updates, 0)
+
+	// The client reconnects, but the controller doesn't answer the
+	// re-issued subscription in time.
+	srv.SetUnresponsive(true)
+	srv.DropConnections()
+	expectEvent(t, ch, Reconnecting)
+	expectEvent(t, ch, Connected)
+
+	subscribes := func() int {
+		n := 0
+		for _, req := range srv.Requests() {
+			if req.CommuniqueType == "SubscribeRequest" {
+				n++
+			}
+		}
+		return n
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for subscribes() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the subscription to be retried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// It keeps retrying until the controller answers.
+	srv.SetUnresponsive(false)
+	expectLevel(t, updates, 0)
+	srv.SetZoneLevel("/zone/1", 42)
+	expectLevel(t, updates, 42)
+}
+
+// overflow pushes more updates than a subscription to /zone/1/status can
+// buffer, then waits for the client to read them.
+func overflow(t *testing.T, srv *leaptest.Server, c *Client) {
+	t.Helper()
+
+	for level := 1; level <= 60; level++ {
+		srv.SetZoneLevel("/zone/1", level)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.PingContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconnectSlowSubscriber(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+	events(c, ReconnectPolicy{})
+
+	updates, err := c.Subscribe("/zone/1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overflow(t, srv, c)
+
+	// Every update is delivered in order, and the subscription stays open.
+	for level := 0; level <= 60; level++ {
+		expectLevel(t, updates, level)
+	}
+	srv.SetZoneLevel("/zone/1", 42)
+	expectLevel(t, updates, 42)
+}
+
+func TestReconnectByRequest(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+	ch := events(c, ReconnectPolicy{InitialDelay: 10 * time.Second})
+
+	updates, err := c.Subscribe("/zone/1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, ch, Connected)
+	expectLevel(t, updates, 0)
+
+	srv.DropConnections()
+	expectEvent(t, ch, Reconnecting)
+
+	// A request reconnects long before the supervisor would, and the
+	// subscription is re-issued on its session.
+	_, err = c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, ch, Connected)
+	expectLevel(t, updates, 0)
+	srv.SetZoneLevel("/zone/1", 42)
+	expectLevel(t, updates, 42)
+}
+
+func TestReconnectCloseUndrained(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+	events(c, ReconnectPolicy{})
+
+	updates, err := c.Subscribe("/zone/1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overflow(t, srv, c)
+
+	closed := make(chan error)
+	go func() { closed <- c.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() hung")
+	}
+
+	for range updates {
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	policy := ReconnectPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt, nominal := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			d := policy.delay(attempt)
+			if d < nominal/2 || d > nominal {
+				t.Errorf("delay(%d) = %v, want between %v and %v", attempt, d, nominal/2, nominal)
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Directions of a recorded communique, relative to the client.
+const (
+	Sent     = "sent"
+	Received = "received"
+)
+
+// RecordedCommunique is one line of a recording.
+type RecordedCommunique struct {
+	Time       time.Time
+	Direction  string // Sent or Received
+	Communique json.RawMessage
+}
+
+// Recorder writes every communique exchanged with the controller to a JSON
+// lines file, which can be replayed later with a Replay. Pairing isn't
+// recorded.
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder returns a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+func (r *Recorder) record(direction string, message []byte) error {
+	raw, err := json.Marshal(RecordedCommunique{
+		Time:       time.Now(),
+		Direction:  direction,
+		Communique: json.RawMessage(bytes.TrimSpace(message)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record communique: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.w.Write(append(raw, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to record communique: %w", err)
+	}
+	return nil
+}
+
+// Replay answers requests from a recording instead of a controller, so a
+// Client can run offline. Each request is answered with the responses that
+// followed the same request (ignoring its `ClientTag`) in the recording,
+// including any updates pushed for a subscription. Requests are matched in
+// the order they were recorded; once a request's recorded answers run out,
+// the last one is repeated. Requests that were never recorded get a 404.
+type Replay struct {
+	mu        sync.Mutex
+	exchanges []*replayExchange
+}
+
+type replayExchange struct {
+	request   string // see requestKey
+	responses []map[string]any
+	used      bool
+}
+
+// LoadReplay reads a recording written by a Recorder.
+func LoadReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewReplay(f)
+}
+
+// NewReplay reads a recording from r.
+func NewReplay(r io.Reader) (*Replay, error) {
+	p := &Replay{}
+
+	// The exchange currently collecting responses for each tag. Tags are
+	// reused when the client reconnects, so a new request with the same tag
+	// starts a new exchange.
+	open := map[string]*replayExchange{}
+
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var entry RecordedCommunique
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+
+		msg, err := decodeCommunique(entry.Communique)
+		if err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		tag := clientTag(msg)
+
+		switch entry.Direction {
+		case Sent:
+			key, err := requestKey(msg)
+			if err != nil {
+				return nil, fmt.Errorf("recording line %d: %w", line, err)
+			}
+			exchange := &replayExchange{request: key}
+			p.exchanges = append(p.exchanges, exchange)
+			open[tag] = exchange
+		case Received:
+			if exchange, ok := open[tag]; ok && tag != "" {
+				exchange.responses = append(exchange.responses, msg)
+			}
+		default:
+			return nil, fmt.Errorf("recording line %d: unknown direction %q", line, entry.Direction)
+		}
+	}
+
+	return p, nil
+}
+
+// dial returns a connection served by the replay.
+func (p *Replay) dial() net.Conn {
+	client, server := net.Pipe()
+	go p.serve(server)
+	return client
+}
+
+func (p *Replay) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		req, err := decodeCommunique(line)
+		if err != nil {
+			continue
+		}
+
+		for _, res := range p.answer(req) {
+			raw, err := json.Marshal(res)
+			if err != nil {
+				return
+			}
+			_, err = conn.Write(append(raw, '\n'))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// answer returns the recorded responses to req, tagged with its `ClientTag`.
+func (p *Replay) answer(req map[string]any) []map[string]any {
+	tag := clientTag(req)
+	header, _ := req["Header"].(map[string]any)
+	url, _ := header["Url"].(string)
+
+	key, err := requestKey(req)
+	if err != nil {
+		return []map[string]any{replayException(tag, url, "400 BadRequest", err.Error())}
+	}
+
+	p.mu.Lock()
+	var match *replayExchange
+	for _, exchange := range p.exchanges {
+		if exchange.request != key {
+			continue
+		}
+		match = exchange
+		if !exchange.used {
+			break
+		}
+	}
+	if match != nil {
+		match.used = true
+	}
+	p.mu.Unlock()
+
+	if match == nil {
+		return []map[string]any{replayException(tag, url, "404 NotFound", fmt.Sprintf("no recorded response to %s %s", req["CommuniqueType"], url))}
+	}
+
+	responses := []map[string]any{}
+	for _, res := range match.responses {
+		res = copyCommunique(res)
+		if header, ok := res["Header"].(map[string]any); ok {
+			header["ClientTag"] = tag
+		}
+		responses = append(responses, res)
+	}
+	return responses
+}
+
+func replayException(tag string, url string, status string, message string) map[string]any {
+	return map[string]any{
+		"CommuniqueType": "ExceptionResponse",
+		"Header": map[string]any{
+			"ClientTag":       tag,
+			"MessageBodyType": "ExceptionDetail",
+			"StatusCode":      status,
+			"Url":             url,
+		},
+		"Body": map[string]any{"Message": message},
+	}
+}
+
+// decodeCommunique decodes a communique, keeping numbers exactly as they were
+// written.
+func decodeCommunique(raw []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var msg map[string]any
+	err := dec.Decode(&msg)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("communique is not an object")
+	}
+	return msg, nil
+}
+
+// copyCommunique copies the communique and its header, so the header can be
+// modified.
+func copyCommunique(msg map[string]any) map[string]any {
+	c := map[string]any{}
+	for k, v := range msg {
+		c[k] = v
+	}
+	if header, ok := msg["Header"].(map[string]any); ok {
+		h := map[string]any{}
+		for k, v := range header {
+			h[k] = v
+		}
+		c["Header"] = h
+	}
+	return c
+}
+
+func clientTag(msg map[string]any) string {
+	header, _ := msg["Header"].(map[string]any)
+	tag, _ := header["ClientTag"].(string)
+	return tag
+}
+
+// requestKey identifies a request by everything but its `ClientTag`.
+func requestKey(msg map[string]any) (string, error) {
+	header, _ := msg["Header"].(map[string]any)
+
+	key := map[string]any{
+		"CommuniqueType": msg["CommuniqueType"],
+		"RequestType":    header["RequestType"],
+		"Url":            header["Url"],
+		"Body":           msg["Body"],
+	}
+
+	// Map keys are marshaled in sorted order, so equal requests have equal
+	// keys.
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
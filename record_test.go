@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	var recording bytes.Buffer
+	c.Recorder = NewRecorder(&recording)
+
+	// session runs the same requests against the controller and the replay.
+	type results struct {
+		Ping    PingResponse
+		Devices []DeviceDefinition
+		Before  ZoneStatus
+		After   ZoneStatus
+	}
+	session := func(c *Client) results {
+		var r results
+		var err error
+
+		r.Ping, err = c.Ping()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Devices, err = c.Devices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Before, err = c.ZoneStatus("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.ZoneDim("1", DimOptions{Level: 30})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.After, err = c.ZoneStatus("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	live := session(c)
+	c.Close()
+
+	dec := json.NewDecoder(bytes.NewReader(recording.Bytes()))
+	directions := []string{}
+	for dec.More() {
+		var entry RecordedCommunique
+		err := dec.Decode(&entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Time.IsZero() {
+			t.Error("recorded communique has no timestamp")
+		}
+		directions = append(directions, entry.Direction)
+	}
+	if len(directions) != 10 || directions[0] != Sent || directions[1] != Received {
+		t.Errorf("recorded directions = %v, want 5 request/response pairs", directions)
+	}
+
+	replay, err := NewReplay(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline := &Client{Replay: replay}
+	defer offline.Close()
+
+	replayed := session(offline)
+	if !reflect.DeepEqual(replayed, live) {
+		t.Errorf("replayed results differ:\n got: %+v\nwant: %+v", replayed, live)
+	}
+	if replayed.Before.Level == replayed.After.Level {
+		t.Errorf("replay returned the same status before and after dimming")
+	}
+
+	_, err = offline.Get("/area")
+	if !IsNotFound(err) {
+		t.Errorf("Get(/area) error = %v, want 404 for an unrecorded request", err)
+	}
+}
+
+func TestRecordFailedSend(t *testing.T) {
+	client, server := net.Pipe()
+	server.Close()
+
+	var recording bytes.Buffer
+	s := newSession(client, bufio.NewReader(client), false, NewRecorder(&recording))
+	defer s.close()
+
+	err := s.send(context.Background(), []byte(`{"CommuniqueType":"ReadRequest"}`))
+	if err == nil {
+		t.Fatal("send() succeeded on a closed connection")
+	}
+	if recording.Len() != 0 {
+		t.Errorf("failed request was recorded: %s", recording.String())
+	}
+}
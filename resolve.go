@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AmbiguousNameError is returned when a name matches more than one entity.
+type AmbiguousNameError struct {
+	Kind       string
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousNameError) Error() string {
+	return fmt.Sprintf("%s %q is ambiguous, could be: %s", e.Kind, e.Name, strings.Join(e.Candidates, ", "))
+}
+
+// NameNotFoundError is returned when a name matches nothing.
+type NameNotFoundError struct {
+	Kind string
+	Name string
+}
+
+func (e *NameNotFoundError) Error() string {
+	return fmt.Sprintf("no %s matches %q", e.Kind, e.Name)
+}
+
+// nameCandidate is an entity that can be referred to by any of its name
+// paths, e.g. ["Home", "Living Room", "Main Lights"].
+type nameCandidate struct {
+	Href  string
+	Paths [][]string
+}
+
+// splitRef splits a user-supplied reference into its name segments.
+func splitRef(ref string) []string {
+	segments := []string{}
+	for _, s := range strings.Split(ref, "/") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// literalID returns the ID in ref if ref is already a numeric ID or an href
+// of the given kind (e.g. "12" or "/zone/12").
+func literalID(kind string, ref string) (string, bool) {
+	if _, err := strconv.Atoi(ref); err == nil {
+		return ref, true
+	}
+
+	prefix := "/" + kind + "/"
+	if strings.HasPrefix(ref, prefix) {
+		id := strings.TrimPrefix(ref, prefix)
+		if _, err := strconv.Atoi(id); err == nil {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// matchPath reports whether the query segments match the trailing segments of
+// path, either exactly or by prefix (case-insensitively).
+func matchPath(query []string, path []string, prefix bool) bool {
+	if len(query) == 0 || len(query) > len(path) {
+		return false
+	}
+
+	offset := len(path) - len(query)
+	for i, q := range query {
+		p := path[offset+i]
+		if prefix {
+			if len(q) > len(p) || !strings.EqualFold(q, p[:len(q)]) {
+				return false
+			}
+		} else if !strings.EqualFold(q, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resolveName finds the single candidate referred to by ref. Exact matches
+// win over prefix matches; anything else that isn't unique is an error.
+func resolveName(kind string, ref string, candidates []nameCandidate) (string, error) {
+	return matchName(kind, ref, candidates, false, true)
+}
+
+// resolveExactName is like resolveName, but doesn't accept prefixes.
+func resolveExactName(kind string, ref string, candidates []nameCandidate) (string, error) {
+	return matchName(kind, ref, candidates, false)
+}
+
+// matchName finds the single candidate matching ref, trying exact matches
+// and then prefix matches, as requested.
+func matchName(kind string, ref string, candidates []nameCandidate, modes ...bool) (string, error) {
+	query := splitRef(ref)
+
+	for _, prefix := range modes {
+		matches := []string{}
+		labels := []string{}
+		for _, candidate := range candidates {
+			for _, path := range candidate.Paths {
+				if matchPath(query, path, prefix) {
+					matches = append(matches, candidate.Href)
+					labels = append(labels, fmt.Sprintf("%s (%s)", strings.Join(path, "/"), candidate.Href))
+					break
+				}
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return idFromHref(matches[0]), nil
+		default:
+			sort.Strings(labels)
+			return "", &AmbiguousNameError{Kind: kind, Name: ref, Candidates: labels}
+		}
+	}
+
+	return "", &NameNotFoundError{Kind: kind, Name: ref}
+}
+
+// areaPaths maps each area's href to its name path from the root area down.
+func areaPaths(areas []AreaDefinition) map[string][]string {
+	byHref := map[string]AreaDefinition{}
+	for _, area := range areas {
+		byHref[area.Href] = area
+	}
+
+	paths := map[string][]string{}
+	for _, area := range areas {
+		path := []string{}
+		seen := map[string]bool{}
+		for a, ok := area, true; ok && !seen[a.Href]; a, ok = byHref[a.Parent.Href] {
+			seen[a.Href] = true
+			path = append([]string{a.Name}, path...)
+		}
+		paths[area.Href] = path
+	}
+
+	return paths
+}
+
+func appendName(path []string, name string) []string {
+	return append(append([]string{}, path...), name)
+}
+
+// ResolveArea returns the ID of the area referred to by ref, which may be an
+// ID, an href, or a name path like "Home/Living Room". Names match
+// case-insensitively, and any unique prefix of each segment will do.
+func (c *Client) ResolveArea(ref string) (string, error) {
+	return c.ResolveAreaContext(context.Background(), ref)
+}
+
+// ResolveAreaContext is like ResolveArea but uses the provided context.
+func (c *Client) ResolveAreaContext(ctx context.Context, ref string) (string, error) {
+	if id, ok := literalID("area", ref); ok {
+		return id, nil
+	}
+
+	areas, err := c.AreasContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	paths := areaPaths(areas)
+	candidates := []nameCandidate{}
+	for _, area := range areas {
+		candidates = append(candidates, nameCandidate{
+			Href:  area.Href,
+			Paths: [][]string{paths[area.Href]},
+		})
+	}
+
+	return resolveName("area", ref, candidates)
+}
+
+// ResolveDevice returns the ID of the device referred to by ref, which may be
+// an ID, an href, or a name path like "Living Room/Main Lights" (see
+// ResolveArea).
+func (c *Client) ResolveDevice(ref string) (string, error) {
+	return c.ResolveDeviceContext(context.Background(), ref)
+}
+
+// ResolveDeviceContext is like ResolveDevice but uses the provided context.
+func (c *Client) ResolveDeviceContext(ctx context.Context, ref string) (string, error) {
+	if id, ok := literalID("device", ref); ok {
+		return id, nil
+	}
+
+	areas, err := c.AreasContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	devices, err := c.DevicesContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	paths := areaPaths(areas)
+	candidates := []nameCandidate{}
+	for _, device := range devices {
+		candidates = append(candidates, nameCandidate{
+			Href:  device.Href,
+			Paths: devicePaths(device, paths),
+		})
+	}
+
+	return resolveName("device", ref, candidates)
+}
+
+func devicePaths(device DeviceDefinition, areaPaths map[string][]string) [][]string {
+	paths := [][]string{}
+	if len(device.FullyQualifiedName) > 0 {
+		paths = append(paths, device.FullyQualifiedName)
+	}
+	if area, ok := areaPaths[device.AssociatedArea.Href]; ok {
+		paths = append(paths, appendName(area, device.Name))
+	} else {
+		paths = append(paths, []string{device.Name})
+	}
+	return paths
+}
+
+// ResolveZone returns the ID of the zone referred to by ref, which may be an
+// ID, an href, or a name path like "Living Room/Main Lights" (see
+// ResolveArea). A zone is named after its area and its own name, or the
+// fully qualified name of the device it belongs to.
+func (c *Client) ResolveZone(ref string) (string, error) {
+	return c.ResolveZoneContext(context.Background(), ref)
+}
+
+// ResolveZoneContext is like ResolveZone but uses the provided context.
+func (c *Client) ResolveZoneContext(ctx context.Context, ref string) (string, error) {
+	if id, ok := literalID("zone", ref); ok {
+		return id, nil
+	}
+
+	areas, err := c.AreasContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	devices, err := c.DevicesContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	zones, err := c.ZonesContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	paths := areaPaths(areas)
+	devicesByHref := map[string]DeviceDefinition{}
+	for _, device := range devices {
+		devicesByHref[device.Href] = device
+	}
+
+	candidates := []nameCandidate{}
+	for _, zone := range zones {
+		device, hasDevice := devicesByHref[zone.Device.Href]
+
+		areaHref := zone.AssociatedArea.Href
+		if areaHref == "" && hasDevice {
+			areaHref = device.AssociatedArea.Href
+		}
+
+		candidate := nameCandidate{Href: zone.Href}
+		if area, ok := paths[areaHref]; ok {
+			candidate.Paths = append(candidate.Paths, appendName(area, zone.Name))
+		} else {
+			candidate.Paths = append(candidate.Paths, []string{zone.Name})
+		}
+		if hasDevice && len(device.FullyQualifiedName) > 0 {
+			candidate.Paths = append(candidate.Paths, device.FullyQualifiedName)
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return resolveName("zone", ref, candidates)
+}
+
+// ResolveButton returns the ID of the button referred to by ref, which may be
+// an ID, an href, or the name path of its device followed by the button's
+// engraving or name, like "Living Room/Pico/On" (see ResolveArea).
+func (c *Client) ResolveButton(ref string) (string, error) {
+	return c.ResolveButtonContext(context.Background(), ref)
+}
+
+// ResolveButtonContext is like ResolveButton but uses the provided context.
+func (c *Client) ResolveButtonContext(ctx context.Context, ref string) (string, error) {
+	if id, ok := literalID("button", ref); ok {
+		return id, nil
+	}
+
+	areas, err := c.AreasContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	devices, err := c.DevicesContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	groups, err := c.ButtonGroupsContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	buttons, err := c.ButtonsContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	paths := areaPaths(areas)
+	devicePathsByHref := map[string][][]string{}
+	for _, device := range devices {
+		devicePathsByHref[device.Href] = devicePaths(device, paths)
+	}
+	groupDevice := map[string]string{}
+	for _, group := range groups {
+		groupDevice[group.Href] = group.Parent.Href
+	}
+
+	candidates := []nameCandidate{}
+	for _, button := range buttons {
+		labels := []string{}
+		if button.Engraving.Text != "" {
+			labels = append(labels, button.Engraving.Text)
+		}
+		if button.Name != "" {
+			labels = append(labels, button.Name)
+		}
+
+		parents := devicePathsByHref[groupDevice[button.Parent.Href]]
+		if len(parents) == 0 {
+			parents = [][]string{{}}
+		}
+
+		candidate := nameCandidate{Href: button.Href}
+		for _, parent := range parents {
+			for _, label := range labels {
+				candidate.Paths = append(candidate.Paths, appendName(parent, label))
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return resolveName("button", ref, candidates)
+}
+
+// ResolveScene returns the ID of the scene referred to by ref, which may be an
+// ID, a virtual button href, or the scene's name. Names match
+// case-insensitively, and any unique prefix will do.
+func (c *Client) ResolveScene(ref string) (string, error) {
+	return c.ResolveSceneContext(context.Background(), ref)
+}
+
+// ResolveSceneContext is like ResolveScene but uses the provided context.
+func (c *Client) ResolveSceneContext(ctx context.Context, ref string) (string, error) {
+	return c.resolveScene(ctx, ref, resolveName)
+}
+
+func (c *Client) resolveScene(ctx context.Context, ref string, resolve func(string, string, []nameCandidate) (string, error)) (string, error) {
+	if id, ok := literalID("virtualbutton", ref); ok {
+		return id, nil
+	}
+
+	scenes, err := c.ScenesContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []nameCandidate{}
+	for _, scene := range scenes {
+		candidates = append(candidates, nameCandidate{
+			Href:  scene.Href,
+			Paths: [][]string{{scene.Name}},
+		})
+	}
+
+	return resolve("scene", ref, candidates)
+}
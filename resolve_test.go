@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want []string
+	}{
+		{"Kitchen", []string{"Kitchen"}},
+		{"Home/Kitchen/Pendants", []string{"Home", "Kitchen", "Pendants"}},
+		{" Living Room / Lamp ", []string{"Living Room", "Lamp"}},
+		{"/Kitchen//Pendants/", []string{"Kitchen", "Pendants"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := splitRef(tt.ref); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitRef(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	path := []string{"Home", "Living Room", "Lamp"}
+
+	tests := []struct {
+		query  string
+		prefix bool
+		want   bool
+	}{
+		{"Lamp", false, true},
+		{"lamp", false, true},
+		{"Living Room/Lamp", false, true},
+		{"Home/Living Room/Lamp", false, true},
+		{"La", false, false},
+		{"La", true, true},
+		{"liv/la", true, true},
+		{"Living Room", false, false},
+		{"Living Room", true, false},
+		{"Home/Lamp", false, false},
+		{"Attic/Home/Living Room/Lamp", false, false},
+		{"Lamps", true, false},
+		{"", true, false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(splitRef(tt.query), path, tt.prefix); got != tt.want {
+			t.Errorf("matchPath(%q, prefix=%v) = %v, want %v", tt.query, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	candidates := []nameCandidate{
+		{Href: "/zone/1", Paths: [][]string{{"Kitchen", "Lamp"}}},
+		{Href: "/zone/2", Paths: [][]string{{"Kitchen", "Lamp Post"}}},
+		{Href: "/zone/3", Paths: [][]string{{"Porch", "Lamp Post"}, {"Porch", "Lantern"}}},
+	}
+
+	tests := []struct {
+		ref       string
+		want      string
+		ambiguous []string
+	}{
+		// An exact match wins over the prefix matches.
+		{ref: "Lamp", want: "1"},
+		{ref: "kitchen/lamp", want: "1"},
+		{ref: "Kitchen/Lamp P", want: "2"},
+		{ref: "Porch/Lamp Post", want: "3"},
+		{ref: "Lantern", want: "3"},
+		{ref: "Lamp Post", ambiguous: []string{"Kitchen/Lamp Post (/zone/2)", "Porch/Lamp Post (/zone/3)"}},
+		{ref: "La", ambiguous: []string{"Kitchen/Lamp (/zone/1)", "Kitchen/Lamp Post (/zone/2)", "Porch/Lamp Post (/zone/3)"}},
+	}
+	for _, tt := range tests {
+		id, err := resolveName("zone", tt.ref, candidates)
+		if tt.ambiguous != nil {
+			var ambiguous *AmbiguousNameError
+			if !errors.As(err, &ambiguous) || !reflect.DeepEqual(ambiguous.Candidates, tt.ambiguous) {
+				t.Errorf("resolveName(%q) error = %v, want candidates %q", tt.ref, err, tt.ambiguous)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveName(%q) error = %v", tt.ref, err)
+		} else if id != tt.want {
+			t.Errorf("resolveName(%q) = %s, want %s", tt.ref, id, tt.want)
+		}
+	}
+
+	for _, ref := range []string{"Attic", "Porch/Lamp/Post", ""} {
+		_, err := resolveName("zone", ref, candidates)
+		var notFound *NameNotFoundError
+		if !errors.As(err, &notFound) {
+			t.Errorf("resolveName(%q) error = %v, want NameNotFoundError", ref, err)
+		}
+	}
+
+	if id, err := resolveExactName("zone", "Lantern", candidates); err != nil || id != "3" {
+		t.Errorf("resolveExactName(Lantern) = %s, %v, want 3", id, err)
+	}
+	_, err := resolveExactName("zone", "Kitchen/Lamp P", candidates)
+	var notFound *NameNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("resolveExactName(Kitchen/Lamp P) error = %v, want NameNotFoundError", err)
+	}
+}
+
+// resolveTest is a reference to resolve against testdata/project.json, and
+// either the ID it should resolve to or the error it should fail with.
+type resolveTest struct {
+	ref  string
+	want string
+	err  error
+}
+
+var (
+	errAmbiguous = &AmbiguousNameError{}
+	errNotFound  = &NameNotFoundError{}
+)
+
+func checkResolve(t *testing.T, name string, resolve func(string) (string, error), tests []resolveTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		id, err := resolve(tt.ref)
+		switch tt.err {
+		case nil:
+			if err != nil {
+				t.Errorf("%s(%q) error = %v", name, tt.ref, err)
+			} else if id != tt.want {
+				t.Errorf("%s(%q) = %s, want %s", name, tt.ref, id, tt.want)
+			}
+		case errAmbiguous:
+			var ambiguous *AmbiguousNameError
+			if !errors.As(err, &ambiguous) {
+				t.Errorf("%s(%q) error = %v, want AmbiguousNameError", name, tt.ref, err)
+			}
+		case errNotFound:
+			var notFound *NameNotFoundError
+			if !errors.As(err, &notFound) {
+				t.Errorf("%s(%q) error = %v, want NameNotFoundError", name, tt.ref, err)
+			}
+		}
+	}
+}
+
+func TestResolveArea(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	checkResolve(t, "ResolveArea", c.ResolveArea, []resolveTest{
+		{ref: "3", want: "3"},
+		{ref: "/area/3", want: "3"},
+		{ref: "Home", want: "1"},
+		{ref: "Home/Kitchen", want: "2"},
+		{ref: "kit", want: "2"},
+		{ref: "H/Liv", want: "3"},
+		{ref: "Kitchen/Home", err: errNotFound},
+		{ref: "Garage", err: errNotFound},
+	})
+}
+
+func TestResolveDevice(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	checkResolve(t, "ResolveDevice", c.ResolveDevice, []resolveTest{
+		{ref: "/device/4", want: "4"},
+		{ref: "Pico", want: "4"},
+		{ref: "Smart", want: "1"},
+		{ref: "Kitchen/Pendants", want: "2"},
+		{ref: "Home/Kitchen/Pendants", want: "2"},
+		{ref: "Living Room/Lamp", want: "3"},
+		{ref: "P", err: errAmbiguous},
+		{ref: "Kitchen/Lamp", err: errNotFound},
+	})
+}
+
+func TestResolveZone(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	checkResolve(t, "ResolveZone", c.ResolveZone, []resolveTest{
+		{ref: "/zone/1", want: "1"},
+		{ref: "Pend", want: "1"},
+		{ref: "Kitchen/Pendants", want: "1"},
+		{ref: "Home/Kitchen/Pendants", want: "1"},
+		{ref: "Table Lamp", want: "2"},
+		{ref: "Living Room/Table Lamp", want: "2"},
+		// The zone's device name works too.
+		{ref: "Living Room/Lamp", want: "2"},
+		{ref: "lamp", want: "2"},
+		{ref: "Kitchen/Table Lamp", err: errNotFound},
+		{ref: "Pico", err: errNotFound},
+	})
+}
+
+func TestResolveButton(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	checkResolve(t, "ResolveButton", c.ResolveButton, []resolveTest{
+		{ref: "/button/2", want: "2"},
+		{ref: "Living Room/Pico/On", want: "1"},
+		{ref: "Home/Living Room/Pico/Off", want: "3"},
+		{ref: "Pico/Off", want: "3"},
+		{ref: "Favorite", want: "2"},
+		{ref: "Button 1", want: "1"},
+		{ref: "Pico/Fav", want: "2"},
+		{ref: "O", err: errAmbiguous},
+		{ref: "Button", err: errAmbiguous},
+		{ref: "Kitchen/On", err: errNotFound},
+	})
+}
+
+func TestResolveScene(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"2", "2"},
+		{"/virtualbutton/3", "3"},
+		{"good night", "1"},
+		{"Movie", "3"},
+		{"Good M", "2"},
+	}
+	for _, tt := range tests {
+		id, err := c.ResolveScene(tt.ref)
+		if err != nil {
+			t.Errorf("ResolveScene(%q) error = %v", tt.ref, err)
+		} else if id != tt.want {
+			t.Errorf("ResolveScene(%q) = %s, want %s", tt.ref, id, tt.want)
+		}
+	}
+
+	_, err := c.ResolveScene("Good")
+	var ambiguous *AmbiguousNameError
+	if !errors.As(err, &ambiguous) || len(ambiguous.Candidates) != 2 {
+		t.Errorf("ResolveScene(Good) error = %v, want two candidates", err)
+	}
+
+	// Unprogrammed virtual buttons aren't scenes.
+	_, err = c.ResolveScene("Scene 004")
+	var notFound *NameNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("ResolveScene(Scene 004) error = %v, want NameNotFoundError", err)
+	}
+}
+
+func TestActivateSceneExactName(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	// Partial names resolve, but aren't enough to activate a scene.
+	err := c.ActivateScene("Movie")
+	var notFound *NameNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("ActivateScene(Movie) error = %v, want NameNotFoundError", err)
+	}
+}
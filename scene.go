@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// VirtualButtonDefinition describes a virtual button. Caséta exposes its
+// scenes as programmed virtual buttons.
+type VirtualButtonDefinition struct {
+	Href string `json:"href"`
+	Name string
+
+	ButtonNumber int
+	IsProgrammed bool
+
+	Parent           HrefObject
+	ProgrammingModel HrefObject
+}
+
+type MultipleVirtualButtonDefinition struct {
+	VirtualButtons []VirtualButtonDefinition
+}
+
+type OneVirtualButtonDefinition struct {
+	VirtualButton VirtualButtonDefinition
+}
+
+// VirtualButtons gets the list of virtual buttons defined on this controller,
+// including unprogrammed ones.
+func (c *Client) VirtualButtons() ([]VirtualButtonDefinition, error) {
+	return c.VirtualButtonsContext(context.Background())
+}
+
+// VirtualButtonsContext is like VirtualButtons but uses the provided context.
+func (c *Client) VirtualButtonsContext(ctx context.Context) ([]VirtualButtonDefinition, error) {
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		return snap.VirtualButtons, nil
+	}
+
+	return c.fetchVirtualButtons(ctx)
+}
+
+func (c *Client) fetchVirtualButtons(ctx context.Context) ([]VirtualButtonDefinition, error) {
+	body, err := c.GetContext(ctx, "/virtualbutton")
+	if err != nil {
+		return []VirtualButtonDefinition{}, err
+	}
+
+	var res MultipleVirtualButtonDefinition
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return []VirtualButtonDefinition{}, err
+	}
+
+	return res.VirtualButtons, nil
+}
+
+// VirtualButton gets information about the specified virtual button.
+func (c *Client) VirtualButton(id string) (VirtualButtonDefinition, error) {
+	return c.VirtualButtonContext(context.Background(), id)
+}
+
+// VirtualButtonContext is like VirtualButton but uses the provided context.
+func (c *Client) VirtualButtonContext(ctx context.Context, id string) (VirtualButtonDefinition, error) {
+	href := fmt.Sprintf("/virtualbutton/%s", id)
+
+	if snap := c.cachedSnapshot(ctx); snap != nil {
+		for _, vb := range snap.VirtualButtons {
+			if vb.Href == href {
+				return vb, nil
+			}
+		}
+	}
+
+	body, err := c.GetContext(ctx, href)
+	if err != nil {
+		return VirtualButtonDefinition{}, err
+	}
+
+	var res OneVirtualButtonDefinition
+	err = mapstructure.Decode(body, &res)
+	if err != nil {
+		return VirtualButtonDefinition{}, err
+	}
+
+	return res.VirtualButton, nil
+}
+
+// Scenes gets the list of scenes, i.e. the programmed virtual buttons.
+func (c *Client) Scenes() ([]VirtualButtonDefinition, error) {
+	return c.ScenesContext(context.Background())
+}
+
+// ScenesContext is like Scenes but uses the provided context.
+func (c *Client) ScenesContext(ctx context.Context) ([]VirtualButtonDefinition, error) {
+	list, err := c.VirtualButtonsContext(ctx)
+	if err != nil {
+		return []VirtualButtonDefinition{}, err
+	}
+
+	scenes := []VirtualButtonDefinition{}
+	for _, vb := range list {
+		if vb.IsProgrammed {
+			scenes = append(scenes, vb)
+		}
+	}
+
+	return scenes, nil
+}
+
+// ActivateScene presses the scene's virtual button. The scene may be given by
+// ID, href or its full (case-insensitive) name. Unlike ResolveScene, prefixes
+// aren't accepted, since a partial name could activate the wrong scene.
+func (c *Client) ActivateScene(scene string) error {
+	return c.ActivateSceneContext(context.Background(), scene)
+}
+
+// ActivateSceneContext is like ActivateScene but uses the provided context.
+func (c *Client) ActivateSceneContext(ctx context.Context, scene string) error {
+	id, err := c.resolveScene(ctx, scene, resolveExactName)
+	if err != nil {
+		return err
+	}
+
+	body := ButtonCommandBody{
+		Command: ButtonCommand{
+			CommandType: PressAndRelease,
+		},
+	}
+
+	_, err = c.PostContext(ctx, fmt.Sprintf("/virtualbutton/%s/commandprocessor", id), body)
+	return err
+}
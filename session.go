@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionClosed is returned to callers waiting on a session that has been
+// closed or whose connection has dropped.
+var ErrSessionClosed = errors.New("session closed")
+
+// session multiplexes LEAP requests over a single long-lived connection.
+// Requests are tagged with a per-session sequence number, and a background
+// reader routes each response to the caller waiting on its `ClientTag`.
+// Subscriptions keep their tag for the life of the session, since the
+// controller reuses it for every update it pushes.
+type session struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	verbose  bool
+	recorder *Recorder
+
+	wmu sync.Mutex // serializes writes to conn
+	rmu sync.Mutex // orders recorded requests before their responses
+
+	mu      sync.Mutex
+	seqNo   int
+	pending map[string]chan Response
+	subs    map[string]*subscriber
+	err     error
+
+	done chan struct{}
+}
+
+func newSession(conn net.Conn, r *bufio.Reader, verbose bool, recorder *Recorder) *session {
+	s := &session{
+		conn:     conn,
+		r:        r,
+		verbose:  verbose,
+		recorder: recorder,
+		pending:  map[string]chan Response{},
+		subs:     map[string]*subscriber{},
+		done:     make(chan struct{}),
+	}
+
+	go s.readLoop()
+
+	return s
+}
+
+// alive reports whether the session's connection is still usable.
+func (s *session) alive() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *session) close() error {
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+// send writes the message, giving up at ctx's deadline. A failed write may
+// have left part of the message on the wire, so it ends the session.
+func (s *session) send(ctx context.Context, message []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if s.verbose {
+		os.Stderr.WriteString(fmt.Sprintln("===>", string(message)))
+	}
+	if s.recorder != nil {
+		s.rmu.Lock()
+		defer s.rmu.Unlock()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+		defer s.conn.SetWriteDeadline(time.Time{})
+	}
+
+	_, err := s.conn.Write(append(message, '\n'))
+	if err != nil {
+		s.conn.Close()
+		return err
+	}
+
+	// Only requests the controller may have received are recorded, so a
+	// replay doesn't expect requests that were never sent. The reader waits
+	// to record the response until the request is recorded.
+	if s.recorder != nil {
+		return s.recorder.record(Sent, message)
+	}
+	return nil
+}
+
+func (s *session) readLine() (string, error) {
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return line, err
+	}
+
+	if s.verbose {
+		os.Stderr.WriteString(fmt.Sprintln("<===", strings.TrimRight(line, "\n")))
+	}
+	if s.recorder != nil {
+		s.rmu.Lock()
+		err = s.recorder.record(Received, []byte(line))
+		s.rmu.Unlock()
+		if err != nil {
+			return line, err
+		}
+	}
+
+	return line, nil
+}
+
+// readLoop reads communiques until the connection fails, handing each one to
+// the caller waiting on its tag and to any subscription registered under it.
+// Untagged or unknown messages are dropped. The reader never waits on a
+// subscriber, since subscriptions queue their updates, so one slow subscriber
+// can't stall the rest of the session.
+func (s *session) readLoop() {
+	var err error
+	for {
+		var line string
+		line, err = s.readLine()
+		if err != nil {
+			break
+		}
+
+		var res Response
+		if json.Unmarshal([]byte(line), &res) != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		ch, ok := s.pending[res.Header.ClientTag]
+		if ok {
+			delete(s.pending, res.Header.ClientTag)
+		}
+		sub, subscribed := s.subs[res.Header.ClientTag]
+		s.mu.Unlock()
+
+		if ok {
+			ch <- res
+		}
+		if subscribed {
+			sub.push(res)
+		}
+	}
+
+	s.mu.Lock()
+	s.err = err
+	for tag, ch := range s.pending {
+		close(ch)
+		delete(s.pending, tag)
+	}
+	for tag, sub := range s.subs {
+		sub.end()
+		delete(s.subs, tag)
+	}
+	s.mu.Unlock()
+
+	close(s.done)
+}
+
+// roundTrip tags and sends the request, then waits for the matching response
+// until ctx is done.
+func (s *session) roundTrip(ctx context.Context, req Request) (Response, error) {
+	return s.exchange(ctx, req, nil)
+}
+
+// subscribe sends a subscription request and waits for the controller to
+// acknowledge it. Every communique carrying the subscription's tag, starting
+// with the acknowledgement itself, is delivered in order on the returned
+// channel. The channel is closed once the session has ended and everything
+// before that has been delivered.
+func (s *session) subscribe(ctx context.Context, req Request) (Response, <-chan Response, error) {
+	sub := newSubscriber()
+
+	res, err := s.exchange(ctx, req, sub)
+	if err != nil {
+		sub.stop()
+		return Response{}, nil, err
+	}
+
+	return res, sub.out, nil
+}
+
+// unsubscribe stops routing updates for the subscription that was
+// acknowledged by res, and discards any it hasn't delivered yet. The
+// subscription's channel is left open.
+func (s *session) unsubscribe(res Response) {
+	s.mu.Lock()
+	sub := s.subs[res.Header.ClientTag]
+	delete(s.subs, res.Header.ClientTag)
+	s.mu.Unlock()
+
+	if sub != nil {
+		sub.stop()
+	}
+}
+
+func (s *session) exchange(ctx context.Context, req Request, sub *subscriber) (Response, error) {
+	err := ctx.Err()
+	if err != nil {
+		return Response{}, err
+	}
+
+	ch := make(chan Response, 1)
+
+	s.mu.Lock()
+	if s.err != nil || !s.alive() {
+		s.mu.Unlock()
+		return Response{}, ErrSessionClosed
+	}
+	s.seqNo++
+	tag := strconv.Itoa(s.seqNo)
+	s.pending[tag] = ch
+	if sub != nil {
+		s.subs[tag] = sub
+	}
+	s.mu.Unlock()
+
+	req.Header.ClientTag = tag
+
+	msg, err := json.Marshal(req)
+	if err != nil {
+		s.forget(tag)
+		return Response{}, err
+	}
+
+	err = s.send(ctx, msg)
+	if err != nil {
+		s.forget(tag)
+		return Response{}, err
+	}
+
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return Response{}, ErrSessionClosed
+		}
+		return res, nil
+	case <-ctx.Done():
+		// A late response is dropped by the reader, since nobody is waiting
+		// on its tag anymore.
+		s.forget(tag)
+		return Response{}, ctx.Err()
+	}
+}
+
+func (s *session) forget(tag string) {
+	s.mu.Lock()
+	delete(s.pending, tag)
+	delete(s.subs, tag)
+	s.mu.Unlock()
+}
+
+// subscriber queues a subscription's updates until its channel is read. The
+// queue is unbounded, so that the session's reader never has to wait for a
+// slow subscriber, and never has to drop updates to avoid it.
+type subscriber struct {
+	out chan Response
+
+	mu      sync.Mutex
+	queue   []Response
+	ended   bool
+	stopped bool
+	wake    chan struct{} // signalled when the queue changes
+	stopCh  chan struct{} // closed when stopped
+}
+
+func newSubscriber() *subscriber {
+	sub := &subscriber{
+		out:    make(chan Response),
+		wake:   make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+	}
+
+	go sub.deliver()
+
+	return sub
+}
+
+// push queues an update for delivery.
+func (sub *subscriber) push(res Response) {
+	sub.mu.Lock()
+	if !sub.ended {
+		sub.queue = append(sub.queue, res)
+	}
+	sub.mu.Unlock()
+
+	sub.signal()
+}
+
+// end closes the channel once the queued updates have been delivered.
+func (sub *subscriber) end() {
+	sub.mu.Lock()
+	sub.ended = true
+	sub.mu.Unlock()
+
+	sub.signal()
+}
+
+// stop discards the queued updates and stops delivering them, leaving the
+// channel open.
+func (sub *subscriber) stop() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.stopped {
+		return
+	}
+	sub.queue = nil
+	sub.ended = true
+	sub.stopped = true
+	close(sub.stopCh)
+}
+
+func (sub *subscriber) signal() {
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *subscriber) deliver() {
+	for {
+		sub.mu.Lock()
+		if len(sub.queue) == 0 {
+			ended, stopped := sub.ended, sub.stopped
+			sub.mu.Unlock()
+
+			if ended {
+				if !stopped {
+					close(sub.out)
+				}
+				return
+			}
+
+			select {
+			case <-sub.wake:
+			case <-sub.stopCh:
+				return
+			}
+			continue
+		}
+		res := sub.queue[0]
+		sub.queue[0] = Response{}
+		sub.queue = sub.queue[1:]
+		sub.mu.Unlock()
+
+		select {
+		case sub.out <- res:
+		case <-sub.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import "context"
+
+// IsShadeControlType reports whether zones with the given `ControlType`
+// accept shade commands.
+func IsShadeControlType(controlType string) bool {
+	switch controlType {
+	case "Shade", "ShadeWithTilt", "Tilt":
+		return true
+	default:
+		return false
+	}
+}
+
+type ShadeWithTiltLevelParameters struct {
+	Level int
+	Tilt  int
+}
+
+type TiltParameters struct {
+	Tilt int
+}
+
+// ZoneShadeRaise starts raising the shade. It moves until it reaches its
+// upper limit or ZoneShadeStop is called.
+func (c *Client) ZoneShadeRaise(id string) error {
+	return c.ZoneShadeRaiseContext(context.Background(), id)
+}
+
+// ZoneShadeRaiseContext is like ZoneShadeRaise but uses the provided context.
+func (c *Client) ZoneShadeRaiseContext(ctx context.Context, id string) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{CommandType: "Raise"})
+}
+
+// ZoneShadeLower starts lowering the shade. It moves until it reaches its
+// lower limit or ZoneShadeStop is called.
+func (c *Client) ZoneShadeLower(id string) error {
+	return c.ZoneShadeLowerContext(context.Background(), id)
+}
+
+// ZoneShadeLowerContext is like ZoneShadeLower but uses the provided context.
+func (c *Client) ZoneShadeLowerContext(ctx context.Context, id string) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{CommandType: "Lower"})
+}
+
+// ZoneShadeStop stops a shade that is raising or lowering.
+func (c *Client) ZoneShadeStop(id string) error {
+	return c.ZoneShadeStopContext(context.Background(), id)
+}
+
+// ZoneShadeStopContext is like ZoneShadeStop but uses the provided context.
+func (c *Client) ZoneShadeStopContext(ctx context.Context, id string) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{CommandType: "Stop"})
+}
+
+// ZoneShadeLevel moves the shade to the provided level (0 is closed, 100 is
+// fully open).
+func (c *Client) ZoneShadeLevel(id string, level int) error {
+	return c.ZoneShadeLevelContext(context.Background(), id, level)
+}
+
+// ZoneShadeLevelContext is like ZoneShadeLevel but uses the provided context.
+func (c *Client) ZoneShadeLevelContext(ctx context.Context, id string, level int) error {
+	_, err := c.zoneGoToLevel(ctx, id, DimOptions{Level: level})
+	return err
+}
+
+// ZoneShadeLevelWithTilt moves a `ShadeWithTilt` zone to the provided level
+// and tilt (0-100) in a single motion.
+func (c *Client) ZoneShadeLevelWithTilt(id string, level int, tilt int) error {
+	return c.ZoneShadeLevelWithTiltContext(context.Background(), id, level, tilt)
+}
+
+// ZoneShadeLevelWithTiltContext is like ZoneShadeLevelWithTilt but uses the
+// provided context.
+func (c *Client) ZoneShadeLevelWithTiltContext(ctx context.Context, id string, level int, tilt int) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{
+		CommandType: "GoToShadeLevelWithTilt",
+		ShadeWithTiltLevelParameters: &ShadeWithTiltLevelParameters{
+			Level: level,
+			Tilt:  tilt,
+		},
+	})
+}
+
+// ZoneShadeTilt tilts the blind's slats to the provided position (0-100).
+func (c *Client) ZoneShadeTilt(id string, tilt int) error {
+	return c.ZoneShadeTiltContext(context.Background(), id, tilt)
+}
+
+// ZoneShadeTiltContext is like ZoneShadeTilt but uses the provided context.
+func (c *Client) ZoneShadeTiltContext(ctx context.Context, id string, tilt int) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{
+		CommandType: "GoToTilt",
+		TiltParameters: &TiltParameters{
+			Tilt: tilt,
+		},
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import "context"
+
+// SwitchedLevel is the state of a `Switched` zone.
+type SwitchedLevel string
+
+const (
+	SwitchedOn  SwitchedLevel = "On"
+	SwitchedOff SwitchedLevel = "Off"
+)
+
+// CCOLevel is the state of a `CCO` (contact closure output) zone.
+type CCOLevel string
+
+const (
+	CCOOpen   CCOLevel = "Open"
+	CCOClosed CCOLevel = "Closed"
+)
+
+type SwitchedLevelParameters struct {
+	SwitchedLevel SwitchedLevel
+}
+
+type CCOLevelParameters struct {
+	CCOLevel CCOLevel
+}
+
+// ZoneSwitch turns a `Switched` zone on or off.
+func (c *Client) ZoneSwitch(id string, level SwitchedLevel) error {
+	return c.ZoneSwitchContext(context.Background(), id, level)
+}
+
+// ZoneSwitchContext is like ZoneSwitch but uses the provided context.
+func (c *Client) ZoneSwitchContext(ctx context.Context, id string, level SwitchedLevel) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{
+		CommandType: "GoToSwitchedLevel",
+		SwitchedLevelParameters: &SwitchedLevelParameters{
+			SwitchedLevel: level,
+		},
+	})
+}
+
+// ZoneCCO opens or closes the contact of a `CCO` zone.
+func (c *Client) ZoneCCO(id string, level CCOLevel) error {
+	return c.ZoneCCOContext(context.Background(), id, level)
+}
+
+// ZoneCCOContext is like ZoneCCO but uses the provided context.
+func (c *Client) ZoneCCOContext(ctx context.Context, id string, level CCOLevel) error {
+	return c.zoneCommand(ctx, id, ZoneCommand{
+		CommandType: "GoToCCOLevel",
+		CCOLevelParameters: &CCOLevelParameters{
+			CCOLevel: level,
+		},
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// TreeNode is an entry in the project hierarchy: an area, a device, a zone or
+// a button group.
+type TreeNode struct {
+	Kind string
+	Name string
+	Href string `json:"href"`
+	Type string `json:",omitempty"`
+
+	Children []*TreeNode `json:",omitempty"`
+}
+
+// Tree builds the project hierarchy: areas nested under their parents,
+// devices under their areas, and zones and button groups under their devices.
+// Zones that belong to an area but no device are listed under the area, and
+// anything whose parent is unknown, or areas that are their own ancestors, are
+// returned at the top level.
+func (c *Client) Tree() ([]*TreeNode, error) {
+	return c.TreeContext(context.Background())
+}
+
+// TreeContext is like Tree but uses the provided context.
+func (c *Client) TreeContext(ctx context.Context) ([]*TreeNode, error) {
+	areas, err := c.AreasContext(ctx)
+	if err != nil {
+		return []*TreeNode{}, err
+	}
+	devices, err := c.DevicesContext(ctx)
+	if err != nil {
+		return []*TreeNode{}, err
+	}
+	zones, err := c.ZonesContext(ctx)
+	if err != nil {
+		return []*TreeNode{}, err
+	}
+	groups, err := c.ButtonGroupsContext(ctx)
+	if err != nil && !IsNotFound(err) {
+		return []*TreeNode{}, err
+	}
+
+	return buildTree(areas, devices, zones, groups), nil
+}
+
+func buildTree(areas []AreaDefinition, devices []DeviceDefinition, zones []ZoneDefinition, groups []ButtonGroupDefinition) []*TreeNode {
+	nodes := map[string]*TreeNode{}
+	roots := []*TreeNode{}
+	attach := func(node *TreeNode, parents ...string) {
+		for _, href := range parents {
+			if parent, ok := nodes[href]; ok {
+				parent.Children = append(parent.Children, node)
+				return
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	for _, area := range areas {
+		nodes[area.Href] = &TreeNode{Kind: "area", Name: area.Name, Href: area.Href, Type: area.Category.Type}
+	}
+
+	// Areas whose parents lead back to themselves would never reach the top
+	// level, so they're put there.
+	parents := map[string]string{}
+	for _, area := range areas {
+		parents[area.Href] = area.Parent.Href
+	}
+	cyclic := func(href string) bool {
+		seen := map[string]bool{}
+		for p := parents[href]; p != "" && !seen[p]; p = parents[p] {
+			if p == href {
+				return true
+			}
+			seen[p] = true
+		}
+		return false
+	}
+	for _, area := range areas {
+		if cyclic(area.Href) {
+			roots = append(roots, nodes[area.Href])
+		} else {
+			attach(nodes[area.Href], area.Parent.Href)
+		}
+	}
+
+	for _, device := range devices {
+		nodes[device.Href] = &TreeNode{Kind: "device", Name: device.Name, Href: device.Href, Type: device.DeviceType}
+		attach(nodes[device.Href], device.AssociatedArea.Href)
+	}
+
+	for _, zone := range zones {
+		node := &TreeNode{Kind: "zone", Name: zone.Name, Href: zone.Href, Type: zone.ControlType}
+		attach(node, zone.Device.Href, zone.AssociatedArea.Href)
+	}
+
+	for _, group := range groups {
+		node := &TreeNode{Kind: "buttongroup", Name: "Button Group", Href: group.Href, Type: group.ProgrammingType}
+		attach(node, group.Parent.Href)
+	}
+
+	return roots
+}
+
+// WriteTree renders the nodes as an indented tree.
+func WriteTree(w io.Writer, nodes []*TreeNode) {
+	var walk func(nodes []*TreeNode, prefix string)
+	walk = func(nodes []*TreeNode, prefix string) {
+		for i, node := range nodes {
+			branch, indent := "├── ", "│   "
+			if i == len(nodes)-1 {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Fprintf(w, "%s%s%s\n", prefix, branch, node.label())
+			walk(node.Children, prefix+indent)
+		}
+	}
+
+	for _, node := range nodes {
+		fmt.Fprintln(w, node.label())
+		walk(node.Children, "")
+	}
+}
+
+func (n *TreeNode) label() string {
+	name := n.Name
+	if name == "" {
+		name = n.Kind
+	}
+	if n.Type != "" {
+		return fmt.Sprintf("%s [%s] (%s)", name, n.Type, n.Href)
+	}
+	return fmt.Sprintf("%s (%s)", name, n.Href)
+}
+
+// treeOutput prints the tree as a table with one row per node, with its
+// parent's path in place of the nesting.
+type treeOutput []*TreeNode
+
+func (t treeOutput) rows() any {
+	type row struct {
+		Kind   string
+		Name   string
+		Href   string `json:"href"`
+		Type   string
+		Parent string
+	}
+
+	rows := []row{}
+	var walk func(nodes []*TreeNode, parent string)
+	walk = func(nodes []*TreeNode, parent string) {
+		for _, node := range nodes {
+			rows = append(rows, row{Kind: node.Kind, Name: node.Name, Href: node.Href, Type: node.Type, Parent: parent})
+			walk(node.Children, node.Href)
+		}
+	}
+	walk(t, "")
+
+	return rows
+}
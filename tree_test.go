@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv)
+
+	tree, err := c.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bridge isn't in any area.
+	if len(tree) != 2 || tree[0].Href != "/area/1" || tree[1].Href != "/device/1" {
+		t.Fatalf("got %d roots, want /area/1 and /device/1", len(tree))
+	}
+
+	var buf bytes.Buffer
+	WriteTree(&buf, tree)
+	for _, want := range []string{"Kitchen [Kitchen] (/area/2)", "Pendants [WallDimmer] (/device/2)", "Button Group"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("tree is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestTreeCycle(t *testing.T) {
+	area := func(href string, parent string) AreaDefinition {
+		a := AreaDefinition{Href: href, Name: href}
+		a.Parent.Href = parent
+		return a
+	}
+	areas := []AreaDefinition{
+		area("/area/1", ""),
+		area("/area/2", "/area/3"),
+		area("/area/3", "/area/2"),
+		area("/area/4", "/area/4"),
+		area("/area/5", "/area/2"),
+	}
+
+	roots := buildTree(areas, nil, nil, nil)
+
+	hrefs := []string{}
+	for _, root := range roots {
+		hrefs = append(hrefs, root.Href)
+	}
+	if strings.Join(hrefs, " ") != "/area/1 /area/2 /area/3 /area/4" {
+		t.Errorf("roots = %v, want /area/1 through /area/4", hrefs)
+	}
+	if len(roots[1].Children) != 1 || roots[1].Children[0].Href != "/area/5" {
+		t.Errorf("/area/2 children = %+v, want /area/5", roots[1].Children)
+	}
+
+	// Rendering the tree must terminate.
+	var buf bytes.Buffer
+	WriteTree(&buf, roots)
+	if n := strings.Count(buf.String(), "\n"); n != 5 {
+		t.Errorf("rendered %d lines, want 5:\n%s", n, buf.String())
+	}
+}